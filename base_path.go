@@ -0,0 +1,99 @@
+package martini
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// basePath is mapped on the requests of a Martini instance mounted with SetBasePath.
+type basePath string
+
+// SetBasePath tells Martini it is mounted under prefix, such as "/app" behind a reverse proxy. Requests are
+// handled with the prefix stripped from their path, so routes are added without it, and requests outside of
+// it get a 404. Context.Redirect and the redirects of the router and Static put the prefix back in front of
+// the paths they redirect to. "" or "/" mounts the instance at the root again.
+func (m *Martini) SetBasePath(prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	m.basePath.Store(prefix)
+}
+
+// SetBasePath is Martini.SetBasePath, with the prefix put in front of the URLs rendered by URLFor as well.
+func (m *ClassicMartini) SetBasePath(prefix string) {
+	m.Martini.SetBasePath(prefix)
+	if r, ok := m.Router.(*router); ok {
+		r.routesLock.Lock()
+		r.basePath = m.getBasePath()
+		r.routesLock.Unlock()
+	}
+}
+
+// mountRequest returns req with the base path stripped, along with the base path, or false if req is outside
+// of it and gets a 404. A nil req is returned as it is.
+func (m *Martini) mountRequest(req *http.Request) (*http.Request, string, bool) {
+	prefix := m.getBasePath()
+	if prefix == "" || req == nil {
+		return req, prefix, true
+	}
+	stripped, ok := stripBasePath(req, prefix)
+	return stripped, prefix, ok
+}
+
+// mapBasePath maps the base path on the request context c, for withBasePath.
+func mapBasePath(c *context, prefix string) {
+	if prefix != "" {
+		c.Map(basePath(prefix))
+	}
+}
+
+func (m *Martini) getBasePath() string {
+	prefix, _ := m.basePath.Load().(string)
+	return prefix
+}
+
+// stripBasePath returns a shallow copy of req with prefix stripped from its path, or false if the path is not
+// under prefix.
+func stripBasePath(req *http.Request, prefix string) (*http.Request, bool) {
+	p := req.URL.Path
+	if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+		return nil, false
+	}
+	u := *req.URL
+	u.Path = p[len(prefix):]
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawPath != "" {
+		if strings.HasPrefix(u.RawPath, prefix+"/") {
+			u.RawPath = u.RawPath[len(prefix):]
+		} else {
+			u.RawPath = ""
+		}
+	}
+	stripped := req.WithContext(req.Context())
+	stripped.URL = &u
+	return stripped, true
+}
+
+// withBasePath returns the location a handler redirects req to, with the base path of the Martini instance in
+// front of it if it is a path on the same host. Relative paths are resolved against the path of req first, as
+// http.Redirect would, since that path has the base path stripped.
+func withBasePath(c Context, req *http.Request, location string) string {
+	rv := c.Get(reflect.TypeOf(basePath("")))
+	if !rv.IsValid() {
+		return location
+	}
+	if u, err := url.Parse(location); err != nil || u.Scheme != "" || u.Host != "" {
+		return location
+	}
+	if !strings.HasPrefix(location, "/") {
+		dir, _ := path.Split(req.URL.Path)
+		location = dir + location
+	}
+	return string(rv.Interface().(basePath)) + location
+}
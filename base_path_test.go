@@ -0,0 +1,75 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_SetBasePath(t *testing.T) {
+	m := Classic()
+	m.SetBasePath("app/")
+	m.Get("/", func() string {
+		return "root"
+	})
+	m.Get("/users/:id", func(params Params, req *http.Request) string {
+		return params["id"] + " " + req.URL.Path
+	}).Name("user")
+	m.Get("/old", func(c Context) {
+		c.Redirect("/users/1")
+	})
+	m.Get("/users/old/:id", func(c Context, params Params) {
+		c.Redirect("../" + params["id"])
+	})
+	m.Get("/away", func(c Context) {
+		c.Redirect("http://example.com/users/1")
+	})
+
+	for _, r := range []struct {
+		path, body string
+		code       int
+		location   string
+	}{
+		{"/app", "root", http.StatusOK, ""},
+		{"/app/", "root", http.StatusOK, ""},
+		{"/app/users/1", "1 /users/1", http.StatusOK, ""},
+		{"/users/1", "404 page not found\n", http.StatusNotFound, ""},
+		{"/application", "404 page not found\n", http.StatusNotFound, ""},
+		{"/app/old", "", http.StatusFound, "/app/users/1"},
+		{"/app/users/old/2", "", http.StatusFound, "/app/users/2"},
+		{"/app/away", "", http.StatusFound, "http://example.com/users/1"},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+r.path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Code, r.code)
+		if r.location == "" {
+			expect(t, recorder.Body.String(), r.body)
+		}
+		expect(t, recorder.HeaderMap.Get("Location"), r.location)
+	}
+	expect(t, m.URLFor("user", 1), "/app/users/1")
+
+	// back at the root
+	m.SetBasePath("/")
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users/1", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "1 /users/1")
+	expect(t, m.URLFor("user", 1), "/users/1")
+}
+
+func Test_SetBasePath_TrailingSlashRedirect(t *testing.T) {
+	m := Classic()
+	m.SetBasePath("/app")
+	m.RedirectTrailingSlash(true)
+	m.Get("/users/", func() string {
+		return "users"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/app/users?page=2", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusMovedPermanently)
+	expect(t, recorder.HeaderMap.Get("Location"), "/app/users/?page=2")
+}
@@ -0,0 +1,41 @@
+package martini
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// AuthUser is the name of the user authenticated by BasicAuth or BasicAuthFunc. It is mapped for the handlers
+// that follow, which can ask for it as a martini.AuthUser.
+type AuthUser string
+
+// BasicRealm is the realm sent in the WWW-Authenticate header when basic authentication fails.
+var BasicRealm = "Authorization Required"
+
+// BasicAuth returns a middleware handler that requires HTTP basic authentication with the given username and
+// password. Requests without valid credentials get a 401 and the rest of the chain is skipped.
+func BasicAuth(username, password string) Handler {
+	return BasicAuthFunc(func(user, pass string) bool {
+		// compare both, so the time taken doesn't tell which one was wrong
+		userOk := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+		passOk := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+		return userOk && passOk
+	})
+}
+
+// BasicAuthFunc returns a middleware handler that requires HTTP basic authentication, validating the
+// credentials with the given function. Requests without valid credentials get a 401 and the rest of the
+// chain is skipped.
+func BasicAuthFunc(validate func(user, pass string) bool) Handler {
+	return func(c Context, req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		if !ok || !validate(user, pass) {
+			res := c.ResponseWriter()
+			res.Header().Set("WWW-Authenticate", `Basic realm="`+BasicRealm+`"`)
+			http.Error(res, "401 unauthorized", http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		c.Map(AuthUser(user))
+	}
+}
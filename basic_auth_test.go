@@ -0,0 +1,57 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_BasicAuth(t *testing.T) {
+	m := Classic()
+	m.Use(BasicAuth("foo", "bar"))
+	m.Get("/", func(user AuthUser) string {
+		return "hello " + string(user)
+	})
+
+	for _, creds := range [][2]string{{"", ""}, {"foo", "baz"}, {"fo", "bar"}} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+		if creds[0] != "" {
+			req.SetBasicAuth(creds[0], creds[1])
+		}
+		m.ServeHTTP(recorder, req)
+
+		expect(t, recorder.Code, http.StatusUnauthorized)
+		expect(t, recorder.HeaderMap.Get("WWW-Authenticate"), `Basic realm="Authorization Required"`)
+		expect(t, recorder.Body.String(), "401 unauthorized\n")
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.SetBasicAuth("foo", "bar")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "hello foo")
+}
+
+func Test_BasicAuthFunc(t *testing.T) {
+	m := Classic()
+	m.Get("/", BasicAuthFunc(func(user, pass string) bool {
+		return user == pass
+	}), func(user AuthUser) string {
+		return "hello " + string(user)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.SetBasicAuth("jeremy", "jeremy")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "hello jeremy")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.SetBasicAuth("jeremy", "zhu")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusUnauthorized)
+}
@@ -0,0 +1,179 @@
+package martini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// maxMultipartMemory is the number of bytes of a multipart body Bind keeps in memory, the rest is stored in temporary files.
+const maxMultipartMemory = 32 << 20
+
+// Validator is implemented by structs bound with Bind that validate themselves after being decoded.
+type Validator interface {
+	Validate() error
+}
+
+// Bind returns a middleware handler that decodes the request into a new instance of obj's type and maps it
+// for the handlers that follow. Bodies with a JSON Content-Type are decoded as JSON, anything else is read from
+// the form values, matching fields by their `form` tag or else their name. obj itself is only used for its type:
+//
+//	m.Post("/users", Bind(User{}), func(u User) string { ... })
+//
+// Pass a pointer, such as &User{}, to map a *User instead. If the bound struct implements Validator it is
+// validated after decoding. On a decoding or validation error Bind writes a 400 with the error message and
+// aborts the chain, or a 413 if the body is over the limit set by MaxBodySize.
+func Bind(obj interface{}) Handler {
+	typ := reflect.TypeOf(obj)
+	ptr := typ.Kind() == reflect.Ptr
+	if ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic("martini: Bind requires a struct or a pointer to a struct, got " + reflect.TypeOf(obj).String())
+	}
+
+	return func(c Context, req *http.Request) {
+		v := reflect.New(typ)
+		err := bindRequest(req, v)
+		if err == nil {
+			if validator, ok := v.Interface().(Validator); ok {
+				err = validator.Validate()
+			}
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			if isBodyTooLarge(err) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(c.ResponseWriter(), err.Error(), status)
+			c.Abort()
+			return
+		}
+
+		if ptr {
+			c.Map(v.Interface())
+		} else {
+			c.Map(v.Elem().Interface())
+		}
+	}
+}
+
+func bindRequest(req *http.Request, v reflect.Value) error {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		if req.Body == nil {
+			return nil
+		}
+		if err := json.NewDecoder(req.Body).Decode(v.Interface()); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	case "multipart/form-data":
+		if err := req.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return err
+		}
+	default:
+		if err := req.ParseForm(); err != nil {
+			return err
+		}
+	}
+	return bindForm(v.Elem(), req.Form)
+}
+
+// bindForm sets the fields of the struct v from the form values, descending into embedded structs.
+func bindForm(v reflect.Value, form url.Values) error {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fv := v.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindForm(fv, form); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("form")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		values, ok := form[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+			for j, value := range values {
+				if err := setFormValue(slice.Index(j), value); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := setFormValue(fv, values[0]); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setFormValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			value = "false"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			value = "0"
+		}
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			value = "0"
+		}
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			value = "0"
+		}
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package martini
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type bindAddress struct {
+	City string `form:"city"`
+}
+
+type bindUser struct {
+	bindAddress
+	Name   string   `form:"name" json:"name"`
+	Age    int      `form:"age" json:"age"`
+	Admin  bool     `form:"admin"`
+	Tags   []string `form:"tag"`
+	Secret string   `form:"-"`
+}
+
+func (u bindUser) Validate() error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func Test_Bind_JSON(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := Classic()
+	m.Post("/users", Bind(bindUser{}), func(u bindUser) string {
+		return u.Name + " " + strconv.Itoa(u.Age)
+	})
+
+	req, _ := http.NewRequest("POST", "http://localhost:3000/users", strings.NewReader(`{"name":"jeremy","age":30}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "jeremy 30")
+}
+
+func Test_Bind_Form(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := Classic()
+	var bound *bindUser
+	m.Post("/users", Bind(&bindUser{}), func(u *bindUser) {
+		bound = u
+	})
+
+	body := "name=jeremy&age=30&admin=true&tag=a&tag=b&city=berlin&Secret=x"
+	req, _ := http.NewRequest("POST", "http://localhost:3000/users", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Code, http.StatusOK)
+	refute(t, bound, nil)
+	expect(t, bound.Name, "jeremy")
+	expect(t, bound.Age, 30)
+	expect(t, bound.Admin, true)
+	expect(t, strings.Join(bound.Tags, ","), "a,b")
+	expect(t, bound.City, "berlin")
+	expect(t, bound.Secret, "")
+}
+
+func Test_Bind_Errors(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		message     string
+	}{
+		{"application/json", `{"name":`, "unexpected EOF\n"},
+		{"application/x-www-form-urlencoded", "name=jeremy&age=old", "age: strconv.ParseInt: parsing \"old\": invalid syntax\n"},
+		{"application/x-www-form-urlencoded", "age=30", "name is required\n"},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+
+		m := Classic()
+		called := false
+		m.Post("/users", Bind(bindUser{}), func() {
+			called = true
+		})
+
+		req, _ := http.NewRequest("POST", "http://localhost:3000/users", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		m.ServeHTTP(recorder, req)
+
+		expect(t, called, false)
+		expect(t, recorder.Code, http.StatusBadRequest)
+		expect(t, recorder.Body.String(), test.message)
+	}
+}
@@ -0,0 +1,26 @@
+package martini
+
+import (
+	"net/http"
+)
+
+// MaxBodySize returns a middleware handler that limits request bodies to n bytes. Requests announcing a larger
+// Content-Length get a 413 right away; for the others the body is wrapped with http.MaxBytesReader, so reads past
+// the limit fail and Bind answers them with a 413.
+func MaxBodySize(n int64) Handler {
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		if req.ContentLength > n {
+			http.Error(res, "413 request entity too large", http.StatusRequestEntityTooLarge)
+			c.Abort()
+			return
+		}
+		if req.Body != nil {
+			req.Body = http.MaxBytesReader(res, req.Body, n)
+		}
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past the limit set by MaxBodySize.
+func isBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
@@ -0,0 +1,57 @@
+package martini
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_MaxBodySize(t *testing.T) {
+	m := Classic()
+	m.Use(MaxBodySize(8))
+	m.Post("/", func(req *http.Request) (int, string) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return http.StatusRequestEntityTooLarge, "too large"
+		}
+		return http.StatusOK, string(b)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost:3000/", strings.NewReader("small"))
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "small")
+
+	// announced as too large
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "http://localhost:3000/", strings.NewReader("far too large"))
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	expect(t, recorder.Body.String(), "413 request entity too large\n")
+
+	// found too large while reading
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "http://localhost:3000/", ioutil.NopCloser(strings.NewReader("far too large")))
+	req.ContentLength = -1
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	expect(t, recorder.Body.String(), "too large")
+}
+
+func Test_MaxBodySize_Bind(t *testing.T) {
+	m := Classic()
+	m.Use(MaxBodySize(8))
+	m.Post("/users", Bind(bindUser{}), func(u bindUser) string {
+		return u.Name
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost:3000/users", ioutil.NopCloser(strings.NewReader(`{"name":"jeremy"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+}
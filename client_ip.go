@@ -0,0 +1,97 @@
+package martini
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var trustedProxies []*net.IPNet
+var trustedProxiesLock sync.RWMutex
+
+// SetTrustedProxies sets the proxies ClientIP takes the X-Forwarded-For and X-Real-IP headers from, as CIDRs
+// such as "10.0.0.0/8" or single IP addresses. The headers of any other client are ignored, since anyone can
+// send them. No proxy is trusted by default, calling SetTrustedProxies without arguments restores that.
+func SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("martini: invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("martini: invalid trusted proxy %q", proxy)
+		}
+		nets = append(nets, n)
+	}
+
+	trustedProxiesLock.Lock()
+	defer trustedProxiesLock.Unlock()
+	trustedProxies = nets
+	return nil
+}
+
+// isTrustedProxy reports whether addr is the IP address of a proxy set with SetTrustedProxies.
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	trustedProxiesLock.RLock()
+	defer trustedProxiesLock.RUnlock()
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that made the request. When the request comes from a proxy set
+// with SetTrustedProxies, that is the last address of X-Forwarded-For that isn't a trusted proxy itself, or else
+// the X-Real-IP header. Otherwise it is the address of the connection, without the port.
+func ClientIP(req *http.Request) string {
+	ip := remoteHost(req)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	if forwarded := req.Header["X-Forwarded-For"]; len(forwarded) > 0 {
+		// every proxy appends the address it got the request from, so walk back from the closest one
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				break
+			}
+			ip = addr
+			if !isTrustedProxy(addr) {
+				return ip
+			}
+		}
+		return ip
+	}
+	if real := strings.TrimSpace(req.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	return ip
+}
+
+// remoteHost returns the address of the connection the request came over, without the port.
+func remoteHost(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,53 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ClientIP(t *testing.T) {
+	defer SetTrustedProxies()
+
+	newRequest := func(remoteAddr string, headers ...string) *http.Request {
+		req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+		req.RemoteAddr = remoteAddr
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Add(headers[i], headers[i+1])
+		}
+		return req
+	}
+
+	// no proxy is trusted, the headers are spoofable
+	expect(t, ClientIP(newRequest("10.0.0.1:1234", "X-Forwarded-For", "1.2.3.4", "X-Real-IP", "1.2.3.4")), "10.0.0.1")
+
+	expect(t, SetTrustedProxies("10.0.0.0/8", "192.168.1.1", "::1"), nil)
+	expect(t, ClientIP(newRequest("10.0.0.1:1234", "X-Forwarded-For", "1.2.3.4")), "1.2.3.4")
+	expect(t, ClientIP(newRequest("[::1]:1234", "X-Real-IP", "1.2.3.4")), "1.2.3.4")
+	// the client can't pass itself for someone else by prepending addresses
+	expect(t, ClientIP(newRequest("10.0.0.1:1234", "X-Forwarded-For", "6.6.6.6, 1.2.3.4, 10.0.0.2")), "1.2.3.4")
+	expect(t, ClientIP(newRequest("10.0.0.1:1234", "X-Forwarded-For", "6.6.6.6", "X-Forwarded-For", "1.2.3.4")), "1.2.3.4")
+	expect(t, ClientIP(newRequest("192.168.1.1:1234", "X-Forwarded-For", "garbage, 10.0.0.3")), "10.0.0.3")
+	expect(t, ClientIP(newRequest("192.168.1.2:1234", "X-Forwarded-For", "1.2.3.4")), "192.168.1.2")
+	expect(t, ClientIP(newRequest("10.0.0.1:1234")), "10.0.0.1")
+
+	refute(t, SetTrustedProxies("10.0.0.0/33"), nil)
+	refute(t, SetTrustedProxies("proxy.local"), nil)
+}
+
+func Test_Context_ClientIP(t *testing.T) {
+	defer SetTrustedProxies()
+	SetTrustedProxies("127.0.0.1")
+
+	m := Classic()
+	m.Get("/", func(c Context) string {
+		return c.ClientIP()
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "1.2.3.4")
+}
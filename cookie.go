@@ -0,0 +1,150 @@
+package martini
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecureCookieKeys is the service holding the keys secure cookies are protected with. Map it on the Martini
+// instance to use Context.SetSecureCookie and Context.SecureCookie:
+//
+//	m.Map(martini.SecureCookieKeys{HashKey: []byte("a long random secret")})
+type SecureCookieKeys struct {
+	// HashKey signs the cookies with HMAC-SHA256, so they can't be tampered with. Required.
+	HashKey []byte
+	// BlockKey, when set, encrypts the values with AES-GCM, so they can't be read either.
+	// It must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256.
+	BlockKey []byte
+}
+
+// CookieOptions are the attributes of a cookie set with Context.SetSecureCookie.
+type CookieOptions struct {
+	Path   string
+	Domain string
+	// MaxAge is the number of seconds the cookie is valid for, which is also enforced when reading it back.
+	// Zero makes it a session cookie, a negative value deletes it.
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+var errInvalidCookie = errors.New("martini: invalid secure cookie")
+
+// encode returns the value, encrypted if there is a BlockKey, with its expiry and signature.
+func (k SecureCookieKeys) encode(name, value string, expires int64) (string, error) {
+	data := []byte(value)
+	if len(k.BlockKey) > 0 {
+		gcm, err := k.gcm()
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		data = gcm.Seal(nonce, nonce, data, []byte(name))
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data) + "|" + strconv.FormatInt(expires, 10)
+	return payload + "|" + base64.RawURLEncoding.EncodeToString(k.mac(name, payload)), nil
+}
+
+// decode checks the signature and expiry of the cookie value, then returns the original value.
+func (k SecureCookieKeys) decode(name, cookie string, now time.Time) (string, error) {
+	parts := strings.Split(cookie, "|")
+	if len(parts) != 3 {
+		return "", errInvalidCookie
+	}
+	payload := parts[0] + "|" + parts[1]
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, k.mac(name, payload)) {
+		return "", errInvalidCookie
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || (expires != 0 && now.Unix() > expires) {
+		return "", errInvalidCookie
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errInvalidCookie
+	}
+	if len(k.BlockKey) > 0 {
+		gcm, err := k.gcm()
+		if err != nil {
+			return "", err
+		}
+		if len(data) < gcm.NonceSize() {
+			return "", errInvalidCookie
+		}
+		data, err = gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+		if err != nil {
+			return "", errInvalidCookie
+		}
+	}
+	return string(data), nil
+}
+
+func (k SecureCookieKeys) mac(name, payload string) []byte {
+	h := hmac.New(sha256.New, k.HashKey)
+	h.Write([]byte(name + "|" + payload))
+	return h.Sum(nil)
+}
+
+func (k SecureCookieKeys) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.BlockKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *context) SetSecureCookie(name, value string, opts CookieOptions) {
+	keys := mustGet(c, reflect.TypeOf(SecureCookieKeys{})).(SecureCookieKeys)
+	var expires int64
+	if opts.MaxAge > 0 {
+		expires = time.Now().Add(time.Duration(opts.MaxAge) * time.Second).Unix()
+	}
+	encoded, err := keys.encode(name, value, expires)
+	if err != nil {
+		panic(err)
+	}
+	http.SetCookie(c.ResponseWriter(), &http.Cookie{
+		Name:     name,
+		Value:    encoded,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	})
+}
+
+func (c *context) SecureCookie(name string) (string, bool) {
+	keys := mustGet(c, reflect.TypeOf(SecureCookieKeys{})).(SecureCookieKeys)
+	req := c.Request()
+	if req == nil {
+		return "", false
+	}
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	value, err := keys.decode(name, cookie.Value, time.Now())
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
@@ -0,0 +1,74 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SecureCookie(t *testing.T) {
+	for _, keys := range []SecureCookieKeys{
+		{HashKey: []byte("secret")},
+		{HashKey: []byte("secret"), BlockKey: []byte("0123456789abcdef")},
+	} {
+		m := Classic()
+		m.Map(keys)
+		m.Get("/set", func(c Context) {
+			c.SetSecureCookie("user", "jeremy", CookieOptions{Path: "/", MaxAge: 60, HttpOnly: true})
+		})
+		m.Get("/get", func(c Context) string {
+			value, ok := c.SecureCookie("user")
+			if !ok {
+				return "invalid"
+			}
+			return value
+		})
+
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/set", nil)
+		m.ServeHTTP(recorder, req)
+		cookie := recorder.HeaderMap.Get("Set-Cookie")
+		expect(t, strings.HasPrefix(cookie, "user="), true)
+		expect(t, strings.Contains(cookie, "Max-Age=60; HttpOnly"), true)
+		// encrypted values don't show
+		expect(t, strings.Contains(cookie, "amVyZW15"), len(keys.BlockKey) == 0)
+
+		value := strings.TrimPrefix(strings.Split(cookie, ";")[0], "user=")
+		for sent, body := range map[string]string{
+			value:                "jeremy",
+			"x" + value:          "invalid",
+			value[:len(value)-1]: "invalid",
+			"":                   "invalid",
+		} {
+			recorder = httptest.NewRecorder()
+			req, _ = http.NewRequest("GET", "http://localhost:3000/get", nil)
+			if sent != "" {
+				req.AddCookie(&http.Cookie{Name: "user", Value: sent})
+			}
+			m.ServeHTTP(recorder, req)
+			expect(t, recorder.Body.String(), body)
+		}
+	}
+}
+
+func Test_SecureCookie_Expired(t *testing.T) {
+	keys := SecureCookieKeys{HashKey: []byte("secret")}
+	now := time.Now()
+
+	encoded, err := keys.encode("user", "jeremy", now.Add(-time.Second).Unix())
+	expect(t, err, nil)
+	_, err = keys.decode("user", encoded, now)
+	expect(t, err, errInvalidCookie)
+
+	encoded, err = keys.encode("user", "jeremy", 0)
+	expect(t, err, nil)
+	value, err := keys.decode("user", encoded, now.Add(365*24*time.Hour))
+	expect(t, err, nil)
+	expect(t, value, "jeremy")
+
+	// the signature covers the name
+	_, err = keys.decode("admin", encoded, now)
+	expect(t, err, errInvalidCookie)
+}
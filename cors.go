@@ -0,0 +1,93 @@
+package martini
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CorsOptions is a struct for specifying configuration options for the martini.Cors middleware.
+type CorsOptions struct {
+	// AllowOrigins lists the origins allowed to make cross-origin requests. "*" allows any origin.
+	AllowOrigins []string
+	// AllowOriginFunc, when set, is asked about origins that are not in AllowOrigins.
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods lists the methods allowed in preflight requests. Defaults to GET, POST, PUT, PATCH, DELETE and HEAD.
+	AllowMethods []string
+	// AllowHeaders lists the request headers allowed in preflight requests. Defaults to the headers the preflight asks for.
+	AllowHeaders []string
+	// ExposeHeaders lists the response headers the browser makes available to the page.
+	ExposeHeaders []string
+	// AllowCredentials sets whether the response may be shared when the request carries credentials such as cookies.
+	AllowCredentials bool
+	// MaxAge sets how long the result of a preflight request may be cached. Not sent when zero.
+	MaxAge time.Duration
+}
+
+var defaultCorsMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+// Cors returns a middleware handler that sets the Access-Control-* headers for requests from allowed origins.
+// Preflight requests, OPTIONS requests carrying an Access-Control-Request-Method header, are answered with a 200
+// right away. Requests without an Origin header or from an origin that is not allowed are passed on untouched.
+func Cors(opt CorsOptions) Handler {
+	if len(opt.AllowMethods) == 0 {
+		opt.AllowMethods = defaultCorsMethods
+	}
+	allowAny := false
+	for _, origin := range opt.AllowOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			return
+		}
+		header := res.Header()
+		header.Add("Vary", "Origin")
+		if !allowAny && !opt.allowsOrigin(origin) {
+			return
+		}
+
+		// the wildcard can't be used with credentials
+		if allowAny && !opt.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opt.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if req.Method != "OPTIONS" || req.Header.Get("Access-Control-Request-Method") == "" {
+			if len(opt.ExposeHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(opt.ExposeHeaders, ", "))
+			}
+			return
+		}
+
+		// preflight
+		header.Set("Access-Control-Allow-Methods", strings.Join(opt.AllowMethods, ", "))
+		if len(opt.AllowHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(opt.AllowHeaders, ", "))
+		} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if opt.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.FormatInt(int64(opt.MaxAge/time.Second), 10))
+		}
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+func (opt CorsOptions) allowsOrigin(origin string) bool {
+	for _, allowed := range opt.AllowOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return opt.AllowOriginFunc != nil && opt.AllowOriginFunc(origin)
+}
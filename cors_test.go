@@ -0,0 +1,90 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Cors(t *testing.T) {
+	m := Classic()
+	m.Use(Cors(CorsOptions{
+		AllowOrigins:  []string{"http://example.com"},
+		ExposeHeaders: []string{"X-Total"},
+	}))
+	m.Get("/users", func() string {
+		return "users"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users", nil)
+	req.Header.Set("Origin", "http://example.com")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Body.String(), "users")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Origin"), "http://example.com")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Expose-Headers"), "X-Total")
+	expect(t, recorder.HeaderMap.Get("Vary"), "Origin")
+
+	// other origins don't get the headers, but are still served
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/users", nil)
+	req.Header.Set("Origin", "http://evil.com")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Body.String(), "users")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Origin"), "")
+}
+
+func Test_Cors_Preflight(t *testing.T) {
+	m := Classic()
+	m.Use(Cors(CorsOptions{
+		AllowOriginFunc: func(origin string) bool {
+			return strings.HasSuffix(origin, ".example.com")
+		},
+		AllowMethods:     []string{"GET", "PUT"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	called := false
+	m.Put("/users", func() {
+		called = true
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "http://localhost:3000/users", nil)
+	req.Header.Set("Origin", "http://api.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, X-Token")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, called, false)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Origin"), "http://api.example.com")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Credentials"), "true")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Methods"), "GET, PUT")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Headers"), "Content-Type, X-Token")
+	expect(t, recorder.HeaderMap.Get("Access-Control-Max-Age"), "600")
+}
+
+func Test_Cors_AnyOrigin(t *testing.T) {
+	m := Classic()
+	m.Use(Cors(CorsOptions{AllowOrigins: []string{"*"}}))
+	m.Get("/", func() string {
+		return "hello"
+	})
+
+	// without an Origin the request is not a CORS request
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Origin"), "")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Origin", "http://anywhere.com")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.HeaderMap.Get("Access-Control-Allow-Origin"), "*")
+}
@@ -0,0 +1,39 @@
+package martini
+
+import (
+	gocontext "context"
+	"math"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader is the header Deadline reads the time left to handle a request from, by default.
+const DeadlineHeader = "X-Request-Deadline"
+
+// Deadline returns a middleware handler that honours a deadline set by the caller, typically another service
+// passing on its own: the header, DeadlineHeader unless given, holds the number of milliseconds the request
+// may take. The handlers that follow run with a request context.Context that times out after that long, which
+// they can pass on in turn. If the deadline passes before a handler writes the response, the chain stops with a
+// 503 Service Unavailable. Requests without the header, or with a value that is not a positive number, get no
+// deadline.
+func Deadline(header ...string) Handler {
+	name := DeadlineHeader
+	if len(header) > 0 {
+		name = header[0]
+	}
+
+	return func(c Context) {
+		ms, err := strconv.ParseInt(c.Request().Header.Get(name), 10, 64)
+		if err != nil || ms <= 0 {
+			return
+		}
+		// longer would overflow the time.Duration
+		if max := int64(math.MaxInt64 / time.Millisecond); ms > max {
+			ms = max
+		}
+		ctx, cancel := gocontext.WithTimeout(stdContext(c), time.Duration(ms)*time.Millisecond)
+		defer cancel()
+		mapStdContext(c, ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package martini
+
+import (
+	gocontext "context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Deadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	m := New()
+	m.Use(Deadline())
+	m.Use(func(req *http.Request, ctx gocontext.Context) {
+		expect(t, req.Context(), ctx)
+		deadline, ok = ctx.Deadline()
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("X-Request-Deadline", "5000")
+	start := time.Now()
+	m.ServeHTTP(recorder, req)
+	expect(t, ok, true)
+	expect(t, deadline.Sub(start) > 4*time.Second && deadline.Sub(start) < 6*time.Second, true)
+
+	for _, value := range []string{"", "soon", "-1"} {
+		recorder = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "http://localhost:3000/", nil)
+		req.Header.Set("X-Request-Deadline", value)
+		m.ServeHTTP(recorder, req)
+		expect(t, ok, false)
+	}
+}
+
+func Test_Deadline_Header(t *testing.T) {
+	m := New()
+	m.Use(Deadline("Grpc-Timeout-Ms"))
+	m.Use(func(ctx gocontext.Context) {
+		_, ok := ctx.Deadline()
+		expect(t, ok, true)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Grpc-Timeout-Ms", "100")
+	m.ServeHTTP(recorder, req)
+}
+
+func Test_Deadline_Exceeded(t *testing.T) {
+	called := false
+	m := New()
+	m.Use(Deadline())
+	m.Use(func() {
+		time.Sleep(30 * time.Millisecond)
+	})
+	m.Use(func() {
+		called = true
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("X-Request-Deadline", "10")
+	m.ServeHTTP(recorder, req)
+	expect(t, called, false)
+	expect(t, recorder.Code, http.StatusServiceUnavailable)
+	expect(t, recorder.Body.String(), "503 service unavailable\n")
+}
+
+func Test_Deadline_Overflow(t *testing.T) {
+	var deadline time.Time
+	m := New()
+	m.Use(Deadline())
+	m.Use(func(ctx gocontext.Context) {
+		deadline, _ = ctx.Deadline()
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("X-Request-Deadline", "9223372036854775807")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, deadline.After(time.Now().Add(24*time.Hour)), true)
+}
@@ -2,6 +2,7 @@ package martini
 
 import (
 	"os"
+	"sync"
 )
 
 // Envs
@@ -12,12 +13,44 @@ const (
 )
 
 // Env is the environment that Martini is executing in. The MARTINI_ENV is read on initialization to set this variable.
+// Use SetEnv and GetEnv to change and read it while requests are being served.
 var Env = Dev
 var Root string
 
+var envLock sync.RWMutex
+
+// SetEnv sets the environment Martini is executing in, such as martini.Prod. An empty string leaves it unchanged.
+func SetEnv(e string) {
+	setENV(e)
+}
+
+// GetEnv returns the environment Martini is executing in.
+func GetEnv() string {
+	envLock.RLock()
+	defer envLock.RUnlock()
+	return Env
+}
+
+// IsDev returns whether Martini is executing in the development environment.
+func IsDev() bool {
+	return GetEnv() == Dev
+}
+
+// IsProd returns whether Martini is executing in the production environment.
+func IsProd() bool {
+	return GetEnv() == Prod
+}
+
+// IsTest returns whether Martini is executing in the test environment.
+func IsTest() bool {
+	return GetEnv() == Test
+}
+
 func setENV(e string) {
 	if len(e) > 0 {
+		envLock.Lock()
 		Env = e
+		envLock.Unlock()
 	}
 }
 
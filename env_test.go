@@ -21,6 +21,25 @@ func Test_SetENV(t *testing.T) {
 	}
 }
 
+func Test_EnvHelpers(t *testing.T) {
+	defer SetEnv(Dev)
+
+	SetEnv(Prod)
+	expect(t, GetEnv(), Prod)
+	expect(t, IsProd(), true)
+	expect(t, IsDev(), false)
+
+	SetEnv("")
+	expect(t, GetEnv(), Prod)
+
+	SetEnv(Test)
+	expect(t, IsTest(), true)
+	expect(t, IsProd(), false)
+
+	SetEnv(Dev)
+	expect(t, IsDev(), true)
+}
+
 func Test_Root(t *testing.T) {
 	if len(Root) == 0 {
 		t.Errorf("Expected root path will be set")
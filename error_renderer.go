@@ -0,0 +1,42 @@
+package martini
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ErrorRenderer writes the response for an error status that Martini answers with itself: the 404 and 405
+// of the router, the 500 Recovery writes after a panic, and the 503 of a request past its deadline.
+type ErrorRenderer func(status int, res http.ResponseWriter)
+
+var errorRenderer ErrorRenderer
+var errorRendererLock sync.RWMutex
+
+// SetErrorRenderer replaces the plain text bodies of the error responses Martini writes by default, such as with
+// a JSON envelope for an API:
+//
+//	martini.SetErrorRenderer(func(status int, res http.ResponseWriter) {
+//		res.Header().Set("Content-Type", "application/json")
+//		res.WriteHeader(status)
+//		fmt.Fprintf(res, `{"error": %q}`, http.StatusText(status))
+//	})
+//
+// It applies to the routers' default NotFound and MethodNotAllowed handlers, and to Recovery unless it is
+// given a Formatter, in every environment. nil restores the default bodies.
+func SetErrorRenderer(renderer ErrorRenderer) {
+	errorRendererLock.Lock()
+	defer errorRendererLock.Unlock()
+	errorRenderer = renderer
+}
+
+// renderError writes the error response with the ErrorRenderer, returning false if none is set.
+func renderError(status int, res http.ResponseWriter) bool {
+	errorRendererLock.RLock()
+	renderer := errorRenderer
+	errorRendererLock.RUnlock()
+	if renderer == nil {
+		return false
+	}
+	renderer(status, res)
+	return true
+}
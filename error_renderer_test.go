@@ -0,0 +1,46 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func Test_SetErrorRenderer(t *testing.T) {
+	SetErrorRenderer(func(status int, res http.ResponseWriter) {
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(status)
+		res.Write([]byte(`{"error":` + strconv.Itoa(status) + `}`))
+	})
+	defer SetErrorRenderer(nil)
+
+	m := Classic()
+	m.Get("/panic", func() {
+		panic("here")
+	})
+	m.Post("/post", func() {})
+
+	for _, r := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/missing", http.StatusNotFound},
+		{"GET", "/post", http.StatusMethodNotAllowed},
+		{"GET", "/panic", http.StatusInternalServerError},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, "http://localhost:3000"+r.path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Code, r.status)
+		expect(t, recorder.HeaderMap.Get("Content-Type"), "application/json")
+		expect(t, recorder.Body.String(), `{"error":`+strconv.Itoa(r.status)+`}`)
+	}
+
+	// the defaults are back
+	SetErrorRenderer(nil)
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/missing", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "404 page not found\n")
+}
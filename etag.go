@@ -0,0 +1,169 @@
+package martini
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// defaultETagBufferSize is how much of a response ETag buffers by default.
+const defaultETagBufferSize = 1 << 20
+
+// ETag returns a middleware handler that answers conditional GET requests. The responses of the handlers that
+// follow are buffered, so that a 200 gets an ETag hashed from its body, unless the handler set one. A request
+// whose If-None-Match lists that ETag, or whose If-Modified-Since is not older than the Last-Modified header
+// set by the handler, gets a 304 Not Modified without the body.
+//
+// Responses bigger than maxBufferSize, 1MB unless given, and those the handlers flush, are written as they come
+// instead, without an ETag.
+func ETag(maxBufferSize ...int) Handler {
+	max := defaultETagBufferSize
+	if len(maxBufferSize) > 0 {
+		max = maxBufferSize[0]
+	}
+
+	return func(c Context, req *http.Request) {
+		if req.Method != "GET" {
+			return
+		}
+		w := &etagResponseWriter{ResponseWriter: c.ResponseWriter(), req: req, max: max}
+		c.MapTo(w, (*http.ResponseWriter)(nil))
+		defer w.abandon()
+		c.Next()
+		w.finish()
+	}
+}
+
+// etagResponseWriter buffers the status and the body until the handlers are done, or the body gets too big.
+type etagResponseWriter struct {
+	ResponseWriter
+	req         *http.Request
+	max         int
+	status      int
+	buf         bytes.Buffer
+	passthrough bool // the response goes straight to the ResponseWriter
+	done        bool
+}
+
+func (w *etagResponseWriter) WriteHeader(s int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(s)
+		return
+	}
+	if w.status == 0 {
+		w.status = s
+	}
+}
+
+func (w *etagResponseWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.buf.Len()+len(b) > w.max {
+		w.writeBuffered()
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+func (w *etagResponseWriter) Flush() {
+	if !w.passthrough {
+		w.writeBuffered()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *etagResponseWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *etagResponseWriter) Written() bool {
+	return w.Status() != 0 || w.ResponseWriter.Written()
+}
+
+func (w *etagResponseWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.buf.Len()
+}
+
+// writeBuffered writes what has been buffered so far and lets the rest of the response through.
+func (w *etagResponseWriter) writeBuffered() {
+	w.passthrough = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+}
+
+// finish writes the response once the handlers are done, or a 304 if the client has it already.
+func (w *etagResponseWriter) finish() {
+	w.done = true
+	if w.passthrough || w.status == 0 {
+		w.passthrough = true
+		return
+	}
+
+	h := w.Header()
+	if w.status == http.StatusOK {
+		if h.Get("ETag") == "" {
+			sum := sha1.Sum(w.buf.Bytes())
+			h.Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		}
+		if notModified(w.req, h) {
+			w.passthrough = true
+			for _, k := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+				h.Del(k)
+			}
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.buf.Reset()
+			return
+		}
+	}
+	w.writeBuffered()
+}
+
+// abandon drops the buffered response if a handler panicked, so whoever recovers can write theirs.
+func (w *etagResponseWriter) abandon() {
+	if !w.done {
+		w.passthrough = true
+		w.status = 0
+		w.buf.Reset()
+	}
+}
+
+// notModified reports whether the conditional headers of the request match the response headers h.
+func notModified(req *http.Request, h http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(h.Get("ETag"), "W/")
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ims)
+}
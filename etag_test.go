@@ -0,0 +1,108 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_ETag(t *testing.T) {
+	m := Classic()
+	m.Use(ETag())
+	m.Get("/hello", func() string {
+		return "hello world"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/hello", nil)
+	m.ServeHTTP(recorder, req)
+	etag := recorder.HeaderMap.Get("ETag")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, len(etag), 42)
+	expect(t, recorder.Body.String(), "hello world")
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotModified)
+	expect(t, recorder.Body.String(), "")
+
+	recorder = httptest.NewRecorder()
+	req.Header.Set("If-None-Match", `"other"`)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "hello world")
+}
+
+func Test_ETag_LastModified(t *testing.T) {
+	m := Classic()
+	m.Use(ETag())
+	m.Get("/doc", func(res http.ResponseWriter) string {
+		res.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		return "document"
+	})
+
+	for since, want := range map[string]int{
+		"Wed, 21 Oct 2015 07:28:00 GMT": http.StatusNotModified,
+		"Thu, 22 Oct 2015 07:28:00 GMT": http.StatusNotModified,
+		"Tue, 20 Oct 2015 07:28:00 GMT": http.StatusOK,
+		"not a date":                    http.StatusOK,
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/doc", nil)
+		req.Header.Set("If-Modified-Since", since)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Code, want)
+	}
+}
+
+func Test_ETag_Skipped(t *testing.T) {
+	m := Classic()
+	m.Use(ETag(10))
+	m.Get("/big", func() string {
+		return strings.Repeat("a", 20)
+	})
+	m.Get("/stream", func(res http.ResponseWriter) {
+		res.Write([]byte("chunk"))
+		res.(http.Flusher).Flush()
+		res.Write([]byte("chunk"))
+	})
+	m.Get("/missing", func() (int, string) {
+		return http.StatusNotFound, "missing"
+	})
+	m.Post("/post", func() string {
+		return "posted"
+	})
+
+	for _, r := range []struct{ method, path, body string }{
+		{"GET", "/big", strings.Repeat("a", 20)},
+		{"GET", "/stream", "chunkchunk"},
+		{"GET", "/missing", "missing"},
+		{"POST", "/post", "posted"},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, "http://localhost:3000"+r.path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.HeaderMap.Get("ETag"), "")
+		expect(t, recorder.Body.String(), r.body)
+	}
+}
+
+func Test_ETag_Panic(t *testing.T) {
+	m := New()
+	m.Use(Recovery())
+	m.Use(ETag())
+	m.Use(func(res http.ResponseWriter) {
+		res.Write([]byte("partial"))
+		panic("here is a panic!")
+	})
+
+	SetEnv(Prod)
+	defer SetEnv(Dev)
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Body.String(), "500 Internal Server Error")
+}
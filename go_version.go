@@ -1,7 +1,7 @@
-// +build !go1.1
+// +build !go1.12
 
 package martini
 
 func MartiniDoesNotSupportGo1Point0() {
-	"Martini requires Go 1.1 or greater."
+	"Martini requires Go 1.12 or greater."
 }
@@ -0,0 +1,136 @@
+package martini
+
+import (
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressedTypes lists content types that are already compressed and are passed through as is.
+var compressedTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+}
+
+// Gzip returns a middleware handler that compresses the response body with gzip for clients that
+// accept it. Responses that carry their own Content-Encoding, have no body, or are of an already
+// compressed content type (images, archives, ...) are written uncompressed.
+//
+// Gzip should be used after the Logger, which then reports the compressed size of the response.
+func Gzip() Handler {
+	return func(c Context, req *http.Request) {
+		if req.Method == "HEAD" || !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+			return
+		}
+
+		gzw := &gzipResponseWriter{ResponseWriter: c.ResponseWriter()}
+		gzw.Header().Add("Vary", "Accept-Encoding")
+		c.MapTo(gzw, (*http.ResponseWriter)(nil))
+		// 处理链 panic 时 c.Next() 不会返回，延迟到整个请求结束后再关闭 gzip 流，Recovery 写出的错误页面也能得到完整的压缩输出
+		c.Defer(gzw.close)
+
+		c.Next()
+		// close the stream right away, so the Logger before Gzip reports the whole compressed size
+		gzw.close()
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header value allows a gzip encoded response.
+func acceptsGzip(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.TrimSpace(params[0])
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter decides whether to compress when the header is written, so handlers can still
+// set Content-Type or Content-Encoding before writing the body.
+type gzipResponseWriter struct {
+	ResponseWriter
+	gz         *gzip.Writer
+	compressed bool // the response is gzip encoded, by gz until it is closed
+}
+
+var errGzipClosed = errors.New("martini: write after the gzip stream was closed")
+
+func (w *gzipResponseWriter) WriteHeader(s int) {
+	if w.Written() {
+		w.ResponseWriter.WriteHeader(s)
+		return
+	}
+
+	h := w.Header()
+	if s >= http.StatusOK && s != http.StatusNoContent && s != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && !isCompressedType(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		w.compressed = true
+	}
+	w.ResponseWriter.WriteHeader(s)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.Written() {
+		// sniff the content type before the body is compressed, net/http would otherwise detect gzip
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	if w.compressed {
+		// uncompressed bytes would corrupt the compressed body
+		return 0, errGzipClosed
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz = nil
+	}
+}
+
+func isCompressedType(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range compressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
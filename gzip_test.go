@@ -0,0 +1,134 @@
+package martini
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Gzip(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	m.Use(Gzip())
+	m.Use(func(c Context) {
+		c.Next()
+		// the wrapped writer still reports on the response
+		expect(t, c.ResponseWriter().Status(), http.StatusOK)
+		expect(t, c.ResponseWriter().Written(), true)
+	})
+	m.Use(func(res http.ResponseWriter) {
+		res.Write([]byte("<html><body>hello world</body></html>"))
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.HeaderMap.Get("Content-Encoding"), "gzip")
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "text/html; charset=utf-8")
+	expect(t, recorder.HeaderMap.Get("Vary"), "Accept-Encoding")
+
+	gz, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, string(body), "<html><body>hello world</body></html>")
+}
+
+func Test_Gzip_NotAccepted(t *testing.T) {
+	for _, accept := range []string{"", "deflate", "gzip;q=0"} {
+		recorder := httptest.NewRecorder()
+
+		m := New()
+		m.Use(Gzip())
+		m.Use(func(res http.ResponseWriter) {
+			res.Write([]byte("hello world"))
+		})
+
+		req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		m.ServeHTTP(recorder, req)
+
+		expect(t, recorder.HeaderMap.Get("Content-Encoding"), "")
+		expect(t, recorder.Body.String(), "hello world")
+	}
+}
+
+func Test_Gzip_CompressedType(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	m.Use(Gzip())
+	m.Use(func(res http.ResponseWriter) {
+		res.Header().Set("Content-Type", "image/png")
+		res.Write([]byte("not really a png"))
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.HeaderMap.Get("Content-Encoding"), "")
+	expect(t, recorder.HeaderMap.Get("Vary"), "Accept-Encoding")
+	expect(t, recorder.Body.String(), "not really a png")
+}
+
+func Test_Gzip_Recovery(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	setENV(Prod)
+	defer setENV(Dev)
+	m := Classic()
+	m.Use(Gzip())
+	m.Use(func() {
+		panic("here is a panic!")
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.HeaderMap.Get("Content-Encoding"), "gzip")
+	gz, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, string(body), "500 Internal Server Error")
+}
+
+func Test_Gzip_LoggerSize(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	buff := bytes.NewBufferString("")
+
+	m := New()
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(Logger())
+	m.Use(Gzip())
+	m.Use(func(res http.ResponseWriter) {
+		res.Write([]byte(strings.Repeat("hello world ", 10)))
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.HeaderMap.Get("Content-Encoding"), "gzip")
+	expect(t, strings.Contains(buff.String(), fmt.Sprintf("(%d bytes)", recorder.Body.Len())), true)
+}
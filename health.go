@@ -0,0 +1,89 @@
+package martini
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultHealthTimeout is how long Health waits for its checks, unless given another timeout.
+const DefaultHealthTimeout = 5 * time.Second
+
+// healthReport is the JSON body Health answers with.
+type healthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Health returns a handler for a health or readiness endpoint. It runs the checks concurrently and answers
+// with a 200 if all of them return nil within the timeout, DefaultHealthTimeout by default, or a 503
+// otherwise. The JSON body has the outcome of each check, "ok" or its error:
+//
+//	m.Get("/healthz", martini.Health(map[string]func() error{
+//		"db": db.Ping,
+//	}))
+//
+//	{"status":"ok","checks":{"db":"ok"}}
+//
+// A check that panics or outlives the timeout fails. Add the path to LoggerOptions.SkipPaths to keep the
+// probes out of the logs.
+func Health(checks map[string]func() error, timeout ...time.Duration) Handler {
+	t := DefaultHealthTimeout
+	if len(timeout) > 0 {
+		t = timeout[0]
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := gocontext.WithTimeout(req.Context(), t)
+		defer cancel()
+
+		type result struct {
+			name string
+			err  error
+		}
+		// buffered, so checks that outlive the timeout don't block forever
+		results := make(chan result, len(checks))
+		for name, check := range checks {
+			go func(name string, check func() error) {
+				defer func() {
+					if err := recover(); err != nil {
+						results <- result{name, fmt.Errorf("panic: %v", err)}
+					}
+				}()
+				results <- result{name, check()}
+			}(name, check)
+		}
+
+		report := healthReport{Status: "ok", Checks: make(map[string]string, len(checks))}
+	wait:
+		for range checks {
+			select {
+			case r := <-results:
+				report.Checks[r.name] = "ok"
+				if r.err != nil {
+					report.Checks[r.name] = r.err.Error()
+					report.Status = "unavailable"
+				}
+			case <-ctx.Done():
+				break wait
+			}
+		}
+		for name := range checks {
+			if _, ok := report.Checks[name]; !ok {
+				report.Checks[name] = "timed out"
+				report.Status = "unavailable"
+			}
+		}
+
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.Header().Set("Cache-Control", "no-store")
+		res.WriteHeader(status)
+		json.NewEncoder(res).Encode(report)
+	}
+}
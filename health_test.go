@@ -0,0 +1,55 @@
+package martini
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Health(t *testing.T) {
+	m := Classic()
+	m.Get("/healthz", Health(map[string]func() error{
+		"db":    func() error { return nil },
+		"cache": func() error { return nil },
+	}))
+	m.Get("/readyz", Health(map[string]func() error{
+		"db":    func() error { return nil },
+		"queue": func() error { return errors.New("connection refused") },
+		"index": func() error { panic("broken") },
+	}))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/healthz", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "application/json; charset=utf-8")
+	expect(t, recorder.Body.String(), `{"status":"ok","checks":{"cache":"ok","db":"ok"}}`+"\n")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/readyz", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusServiceUnavailable)
+	expect(t, recorder.Body.String(), `{"status":"unavailable","checks":{"db":"ok","index":"panic: broken","queue":"connection refused"}}`+"\n")
+}
+
+func Test_Health_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	m := Classic()
+	m.Get("/healthz", Health(map[string]func() error{
+		"fast": func() error { return nil },
+		"slow": func() error {
+			<-release
+			return nil
+		},
+	}, 10*time.Millisecond))
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/healthz", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusServiceUnavailable)
+	expect(t, recorder.Body.String(), `{"status":"unavailable","checks":{"fast":"ok","slow":"timed out"}}`+"\n")
+}
@@ -0,0 +1,265 @@
+package martini
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/codegangsta/inject"
+)
+
+// recordingInjector wraps an inject.Injector to make it safe for concurrent use, to remember the types
+// mapped on it so they can be listed, and to build services with factories. It looks values up in its
+// parent itself, so that factories come before the parent's values.
+type recordingInjector struct {
+	inject.Injector
+	lock      sync.RWMutex
+	types     map[reflect.Type]bool
+	factories map[reflect.Type]*serviceFactory
+	parent    inject.Injector
+}
+
+func newInjector() *recordingInjector {
+	return &recordingInjector{Injector: inject.New(), types: make(map[reflect.Type]bool)}
+}
+
+// serviceFactory builds a service with a function mapped with MapFactory, the first time it is needed.
+type serviceFactory struct {
+	fn   interface{}
+	typ  reflect.Type
+	once sync.Once
+	val  reflect.Value
+}
+
+func (f *serviceFactory) get(r *recordingInjector) reflect.Value {
+	f.once.Do(func() {
+		vals, err := invoke(r, f.fn)
+		if err != nil {
+			panic(newInvokeError(err, f.fn))
+		}
+		if len(vals) == 2 && !vals[1].IsNil() {
+			panic(vals[1].Interface())
+		}
+		f.val = vals[0]
+		r.Set(f.typ, f.val)
+	})
+	return f.val
+}
+
+// mapFactory registers fn as the factory of the type of its first result.
+func (r *recordingInjector) mapFactory(fn interface{}) {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumOut() == 0 || t.NumOut() > 2 ||
+		(t.NumOut() == 2 && t.Out(1) != errorType) {
+		panic(fmt.Sprintf("martini: a factory must be a func returning a service and optionally an error, got %v", t))
+	}
+	argTypes(t)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.factories == nil {
+		r.factories = make(map[reflect.Type]*serviceFactory)
+	}
+	r.factories[t.Out(0)] = &serviceFactory{fn: fn, typ: t.Out(0)}
+	r.types[t.Out(0)] = true
+}
+
+func (r *recordingInjector) Map(val interface{}) inject.TypeMapper {
+	return r.Set(reflect.TypeOf(val), reflect.ValueOf(val))
+}
+
+func (r *recordingInjector) MapTo(val interface{}, ifacePtr interface{}) inject.TypeMapper {
+	return r.Set(inject.InterfaceOf(ifacePtr), reflect.ValueOf(val))
+}
+
+func (r *recordingInjector) Set(typ reflect.Type, val reflect.Value) inject.TypeMapper {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Injector.Set(typ, val)
+	r.types[typ] = true
+	return r
+}
+
+func (r *recordingInjector) Get(t reflect.Type) reflect.Value {
+	r.lock.RLock()
+	val := r.Injector.Get(t)
+	factory := r.factories[t]
+	parent := r.parent
+	r.lock.RUnlock()
+
+	if val.IsValid() {
+		return val
+	}
+	if factory != nil {
+		return factory.get(r)
+	}
+	if parent != nil {
+		return parent.Get(t)
+	}
+	return val
+}
+
+// Invoke resolves the arguments through Get, so that the lock is not held while f runs and f may map values.
+func (r *recordingInjector) Invoke(f interface{}) ([]reflect.Value, error) {
+	return invokeReflect(r, f)
+}
+
+// Apply sets the fields of the struct val that have an inject tag, like inject does, through Get.
+func (r *recordingInjector) Apply(val interface{}) error {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		structField := t.Field(i)
+		if f.CanSet() && (structField.Tag == "inject" || structField.Tag.Get("inject") != "") {
+			fv := r.Get(f.Type())
+			if !fv.IsValid() {
+				return missingValueError{f.Type()}
+			}
+			f.Set(fv)
+		}
+	}
+	return nil
+}
+
+func (r *recordingInjector) SetParent(parent inject.Injector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.parent = parent
+}
+
+// reset forgets everything mapped on the injector, and its parent, so it can be reused.
+func (r *recordingInjector) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Injector = inject.New()
+	for t := range r.types {
+		delete(r.types, t)
+	}
+	r.factories = nil
+	r.parent = nil
+}
+
+// mappedTypes returns the types mapped on the injector and, if it lists them too, on its parent, sorted by name.
+func (r *recordingInjector) mappedTypes() []reflect.Type {
+	r.lock.RLock()
+	seen := make(map[reflect.Type]bool, len(r.types))
+	types := make([]reflect.Type, 0, len(r.types))
+	for t := range r.types {
+		seen[t] = true
+		types = append(types, t)
+	}
+	parent := r.parent
+	r.lock.RUnlock()
+
+	if p, ok := parent.(interface{ MappedTypes() []reflect.Type }); ok {
+		for _, t := range p.MappedTypes() {
+			if !seen[t] {
+				types = append(types, t)
+			}
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].String() < types[j].String() })
+	return types
+}
+
+// mappedTypes returns the types mapped on inj, or nil if it doesn't keep track of them.
+func mappedTypes(inj inject.Injector) []reflect.Type {
+	if r, ok := inj.(*recordingInjector); ok {
+		return r.mappedTypes()
+	}
+	return nil
+}
+
+var (
+	contextType        = inject.InterfaceOf((*Context)(nil))
+	responseWriterType = inject.InterfaceOf((*http.ResponseWriter)(nil))
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+)
+
+// invoke calls the handler with its arguments from inj. The most common signatures are called directly,
+// which spares the reflective call, the others go through invokeReflect.
+func invoke(inj inject.Injector, handler Handler) ([]reflect.Value, error) {
+	switch h := handler.(type) {
+	case func():
+		h()
+		return nil, nil
+	case func(Context):
+		if c := inj.Get(contextType); c.IsValid() {
+			h(c.Interface().(Context))
+			return nil, nil
+		}
+	case func(http.ResponseWriter, *http.Request):
+		if invokeHandlerFunc(inj, h) {
+			return nil, nil
+		}
+	case http.HandlerFunc:
+		if invokeHandlerFunc(inj, h) {
+			return nil, nil
+		}
+	}
+	return invokeReflect(inj, handler)
+}
+
+// argTypesCache maps the type of each handler to the types of its arguments.
+var argTypesCache sync.Map
+
+// argTypes returns the argument types of the func type t, which are worked out once per type.
+func argTypes(t reflect.Type) []reflect.Type {
+	if types, ok := argTypesCache.Load(t); ok {
+		return types.([]reflect.Type)
+	}
+	types := make([]reflect.Type, t.NumIn())
+	for i := range types {
+		types[i] = t.In(i)
+	}
+	argTypesCache.Store(t, types)
+	return types
+}
+
+// missingValueError is the error of an invocation needing a type nothing mapped.
+type missingValueError struct {
+	typ reflect.Type
+}
+
+func (e missingValueError) Error() string {
+	return fmt.Sprintf("Value not found for type %v", e.typ)
+}
+
+// invokeReflect calls f through reflection, with its arguments from inj.
+func invokeReflect(inj inject.Injector, f interface{}) ([]reflect.Value, error) {
+	types := argTypes(reflect.TypeOf(f))
+	// most handlers take a few arguments, which then don't need allocating
+	var buf [4]reflect.Value
+	in := buf[:0]
+	if len(types) > len(buf) {
+		in = make([]reflect.Value, 0, len(types))
+	}
+	in = in[:len(types)]
+	for i, argType := range types {
+		val := inj.Get(argType)
+		if !val.IsValid() {
+			return nil, missingValueError{argType}
+		}
+		in[i] = val
+	}
+	return reflect.ValueOf(f).Call(in), nil
+}
+
+// invokeHandlerFunc calls h if the ResponseWriter and the request are mapped on inj.
+func invokeHandlerFunc(inj inject.Injector, h func(http.ResponseWriter, *http.Request)) bool {
+	res, req := inj.Get(responseWriterType), inj.Get(requestType)
+	if !res.IsValid() || !req.IsValid() {
+		return false
+	}
+	h(res.Interface().(http.ResponseWriter), req.Interface().(*http.Request))
+	return true
+}
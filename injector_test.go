@@ -0,0 +1,210 @@
+package martini
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/codegangsta/inject"
+)
+
+func Test_Martini_MappedTypes(t *testing.T) {
+	m := New()
+	m.Map("a string").Map(42)
+
+	types := m.MappedTypes()
+	expect(t, len(types), 4)
+	expect(t, types[0], reflect.TypeOf(&log.Logger{}))
+	expect(t, types[1], reflect.TypeOf(0))
+	expect(t, types[2], reflect.TypeOf(defaultReturnHandler()))
+	expect(t, types[3], reflect.TypeOf(""))
+}
+
+func Test_Context_MappedTypes(t *testing.T) {
+	m := New()
+	m.Map(42)
+	m.Use(func(c Context) {
+		c.Map(int64(1))
+	})
+
+	var types []reflect.Type
+	m.Action(func(c Context) {
+		types = c.MappedTypes()
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+
+	has := func(typ reflect.Type) bool {
+		for _, t := range types {
+			if t == typ {
+				return true
+			}
+		}
+		return false
+	}
+	expect(t, has(reflect.TypeOf(0)), true)
+	expect(t, has(reflect.TypeOf(int64(0))), true)
+	expect(t, has(inject.InterfaceOf((*Context)(nil))), true)
+	expect(t, has(reflect.TypeOf(req)), true)
+	expect(t, has(reflect.TypeOf(int32(0))), false)
+}
+
+func Test_Context_ConcurrentInjection(t *testing.T) {
+	m := New()
+	m.Use(func(c Context) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c.Map(i)
+				c.Get(reflect.TypeOf(0))
+				c.Invoke(func(n int, req *http.Request) {})
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+}
+
+func Test_Invoke_FastPaths(t *testing.T) {
+	m := New()
+	m.Use(func(c Context, res http.ResponseWriter) {
+		// the fast paths get the mapped values too
+		c.MapTo(&headerWriter{res}, (*http.ResponseWriter)(nil))
+	})
+	m.Use(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("X-Handlers", "func")
+	})
+	m.Use(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("X-Handlers", "HandlerFunc")
+	}))
+	m.Use(func(c Context) {
+		c.ResponseWriter().Header().Add("X-Handlers", "Context")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, strings.Join(recorder.HeaderMap["X-Handlers"], ","), "func,HandlerFunc,Context")
+	expect(t, recorder.HeaderMap.Get("X-Wrapped"), "true")
+}
+
+// headerWriter marks the headers it was asked for.
+type headerWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headerWriter) Header() http.Header {
+	h := w.ResponseWriter.Header()
+	h.Set("X-Wrapped", "true")
+	return h
+}
+
+func benchmarkInjector(inj inject.Injector) inject.Injector {
+	inj.MapTo(httptest.NewRecorder(), (*http.ResponseWriter)(nil))
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	inj.Map(req)
+	return inj
+}
+
+func Benchmark_Invoke_FastPath(b *testing.B) {
+	inj := benchmarkInjector(newInjector())
+	handler := func(res http.ResponseWriter, req *http.Request) {}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		invoke(inj, handler)
+	}
+}
+
+func Benchmark_Invoke_Reflect(b *testing.B) {
+	inj := benchmarkInjector(newInjector())
+	handler := func(req *http.Request, res http.ResponseWriter) {}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		invoke(inj, handler)
+	}
+}
+
+// Benchmark_Invoke_Uncached invokes the handler of Benchmark_Invoke_Reflect working out the argument types
+// on every call, as inject does.
+func Benchmark_Invoke_Uncached(b *testing.B) {
+	inj := benchmarkInjector(newInjector())
+	handler := func(req *http.Request, res http.ResponseWriter) {}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t := reflect.TypeOf(handler)
+		in := make([]reflect.Value, t.NumIn())
+		for j := 0; j < t.NumIn(); j++ {
+			in[j] = inj.Get(t.In(j))
+		}
+		reflect.ValueOf(handler).Call(in)
+	}
+}
+
+type lazyService struct {
+	path string
+}
+
+func Test_Context_MapFactory(t *testing.T) {
+	calls := 0
+	m := New()
+	m.Use(func(c Context) {
+		c.MapFactory(func(req *http.Request) *lazyService {
+			calls++
+			return &lazyService{req.URL.Path}
+		})
+	})
+	m.Use(func(c Context, req *http.Request) {
+		if req.URL.Path == "/unused" {
+			c.Abort()
+		}
+	})
+	var first, second *lazyService
+	m.Use(func(s *lazyService) {
+		first = s
+	})
+	m.Use(func(s *lazyService) {
+		second = s
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/used", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, calls, 1)
+	expect(t, first.path, "/used")
+	expect(t, first, second)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/unused", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, calls, 1)
+}
+
+func Test_Context_MapFactory_Error(t *testing.T) {
+	m := New()
+	m.Use(Recovery())
+	m.Use(func(c Context) {
+		c.MapFactory(func() (*lazyService, error) {
+			return nil, errors.New("no service")
+		})
+	})
+	m.Use(func(s *lazyService) {
+		t.Error("the handler should not run")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+}
@@ -1,8 +1,10 @@
 package martini
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,22 +17,94 @@ import (
 
 // Logger returns a middleware handler that logs the request as it goes in and the response as it goes out.
 func Logger() Handler {
+	return LoggerWithOptions(LoggerOptions{})
+}
+
+// LoggerOptions is a struct for specifying configuration options for the martini.Logger middleware.
+type LoggerOptions struct {
+	// Format, when set, logs one line per request rendered by it once the response has gone out, in place of
+	// the Started and Completed lines.
+	Format LogFormatter
+	// SkipPaths lists path prefixes, such as "/healthz", of requests that are not logged.
+	SkipPaths []string
+	// Skip, when set, is asked whether a request should not be logged.
+	Skip func(*http.Request) bool
+}
+
+// LoggerWithOptions returns a middleware handler that logs requests like Logger does, configured by the given
+// options. Skipped requests are handled as usual, they are only left out of the log.
+func LoggerWithOptions(opt LoggerOptions) Handler {
 	return func(res http.ResponseWriter, req *http.Request, c Context, log *log.Logger) {
+		if opt.skips(req) {
+			return
+		}
+
 		start := time.Now()
+		addr := ClientIP(req)
+		if opt.Format == nil {
+			log.Printf("Started %s %s for %s", req.Method, req.URL.Path, addr)
+		}
 
-		addr := req.Header.Get("X-Real-IP")
-		if addr == "" {
-			addr = req.Header.Get("X-Forwarded-For")
-			if addr == "" {
-				addr = req.RemoteAddr
+		rw := res.(ResponseWriter)
+		c.Next()
+
+		if opt.Format == nil {
+			if hijacked(rw) {
+				// the response went out over the hijacked connection, its status is unknown
+				log.Printf("Hijacked connection in %v\n", time.Since(start))
+				return
 			}
+			log.Printf("Completed %v %s (%d bytes) in %v\n", rw.Status(), http.StatusText(rw.Status()), rw.Size(), time.Since(start))
+			return
 		}
+		log.Println(opt.Format(LogEntry{
+			StartTime:  start,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			RemoteAddr: addr,
+			Status:     rw.Status(),
+			Size:       rw.Size(),
+			Duration:   time.Since(start),
+			Hijacked:   hijacked(rw),
+		}))
+	}
+}
 
-		log.Printf("Started %s %s for %s", req.Method, req.URL.Path, addr)
+func (opt LoggerOptions) skips(req *http.Request) bool {
+	for _, prefix := range opt.SkipPaths {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return true
+		}
+	}
+	return opt.Skip != nil && opt.Skip(req)
+}
 
-		rw := res.(ResponseWriter)
-		c.Next()
+// LogEntry holds the details of a handled request that are passed to a LogFormatter.
+type LogEntry struct {
+	StartTime  time.Time     `json:"start_time"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	RemoteAddr string        `json:"remote_addr"`
+	Status     int           `json:"status"`
+	Size       int           `json:"size"`
+	Duration   time.Duration `json:"duration"`
+	// Hijacked is set when the connection was hijacked, Status and Size are 0 then.
+	Hijacked bool `json:"hijacked,omitempty"`
+}
+
+// LogFormatter renders a LogEntry as a single log line.
+type LogFormatter func(LogEntry) string
 
-		log.Printf("Completed %v %s in %v\n", rw.Status(), http.StatusText(rw.Status()), time.Since(start))
+// JSONLogFormatter is a LogFormatter that renders the LogEntry as a JSON object.
+func JSONLogFormatter(entry LogEntry) string {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err.Error()
 	}
+	return string(b)
+}
+
+// LoggerWithFormat returns a middleware handler that logs one line per request, rendered by format, once the response has gone out.
+func LoggerWithFormat(format LogFormatter) Handler {
+	return LoggerWithOptions(LoggerOptions{Format: format})
 }
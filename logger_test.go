@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -29,3 +30,115 @@ func Test_Logger(t *testing.T) {
 	expect(t, recorder.Code, http.StatusNotFound)
 	refute(t, len(buff.String()), 0)
 }
+
+func Test_Logger_Size(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	// replace log for testing
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(Logger())
+	m.Use(func(c Context, res http.ResponseWriter) {
+		res.Write([]byte("Hello"))
+		c.Next()
+	})
+	m.Use(func(res http.ResponseWriter) {
+		res.Write([]byte(" world"))
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:3000/foobar", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	m.ServeHTTP(recorder, req)
+	expect(t, strings.Contains(buff.String(), "Completed 200 OK (11 bytes) in"), true)
+}
+
+func Test_Logger_Hijacked(t *testing.T) {
+	buff := bytes.NewBufferString("")
+
+	m := New()
+	// replace log for testing
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(Logger())
+	m.Use(func(res http.ResponseWriter) {
+		res.(http.Hijacker).Hijack()
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:3000/socket", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	m.ServeHTTP(newHijackableResponse(), req)
+	expect(t, strings.Contains(buff.String(), "Hijacked connection in"), true)
+	expect(t, strings.Contains(buff.String(), "Completed"), false)
+}
+
+func Test_LoggerWithFormat(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	// replace log for testing
+	m.Map(log.New(buff, "", 0))
+	m.Use(LoggerWithFormat(JSONLogFormatter))
+	m.Use(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusNotFound)
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:3000/foobar", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+
+	line := buff.String()
+	expect(t, strings.Count(line, "\n"), 1)
+	expect(t, strings.Contains(line, `"method":"GET"`), true)
+	expect(t, strings.Contains(line, `"path":"/foobar"`), true)
+	expect(t, strings.Contains(line, `"remote_addr":"10.0.0.1"`), true)
+	expect(t, strings.Contains(line, `"status":404`), true)
+	expect(t, strings.Contains(line, `"size":0`), true)
+}
+
+func Test_LoggerWithOptions_Skip(t *testing.T) {
+	buff := bytes.NewBufferString("")
+
+	m := New()
+	// replace log for testing
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(LoggerWithOptions(LoggerOptions{
+		SkipPaths: []string{"/healthz", "/metrics"},
+		Skip: func(req *http.Request) bool {
+			return req.Header.Get("X-Probe") != ""
+		},
+	}))
+	m.Use(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, path := range []string{"/healthz", "/metrics/cpu", "/probed"} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+path, nil)
+		if path == "/probed" {
+			req.Header.Set("X-Probe", "1")
+		}
+		m.ServeHTTP(recorder, req)
+
+		// still handled, but not logged
+		expect(t, recorder.Code, http.StatusNoContent)
+		expect(t, buff.String(), "")
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, strings.Contains(buff.String(), "Started GET /users"), true)
+	expect(t, strings.Contains(buff.String(), "Completed 204 No Content"), true)
+}
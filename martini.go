@@ -18,10 +18,20 @@
 package martini
 
 import (
+	gocontext "context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/codegangsta/inject"
 )
@@ -32,16 +42,54 @@ type Martini struct {
 	handlers []Handler 		//存储所有中间件
 	action   Handler 		//路由匹配以及路由处理，在所有中间件都处理完之后执行
 	logger   *log.Logger   	//日志工具
+	server   atomic.Value  // the *http.Server the instance was last run with, read by Server from other goroutines
+
+	handlersLock sync.RWMutex // guards handlers and action, which are replaced rather than modified in place
+
+	injectables map[reflect.Type]bool // request-level types handlers may ask for, nil unless ValidateInjection was called
+
+	basePath atomic.Value // the string prefix set with SetBasePath
 }
 
 
 
 
 // New creates a bare bones Martini instance. Use this method if you want to have full control over the middleware that is used.
+// Options, such as WithService, are applied in order once the instance is set up:
+//
+//	m := martini.New(martini.WithService(db), martini.WithServiceTo(cache, (*Cache)(nil)))
+//
 // 基础骨架：具备基本的注入与反射调用功能
-func New() *Martini {
-	m := &Martini{Injector: inject.New(), action: func() {}, logger: log.New(os.Stdout, "[martini] ", 0)}
-	m.Map(m.logger)				  //标准输出的logger
+func New(options ...Option) *Martini {
+	m := NewWithLogger(log.New(os.Stdout, "[martini] ", 0)) //标准输出的logger
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// Option configures a Martini instance created with New or Classic.
+type Option func(*Martini)
+
+// WithService maps val as a global service, like Martini.Map.
+func WithService(val interface{}) Option {
+	return func(m *Martini) {
+		m.Map(val)
+	}
+}
+
+// WithServiceTo maps val as a global service for the interface ifacePtr points to, like Martini.MapTo.
+func WithServiceTo(val interface{}, ifacePtr interface{}) Option {
+	return func(m *Martini) {
+		m.MapTo(val, ifacePtr)
+	}
+}
+
+// NewWithLogger creates a bare bones Martini instance like New, logging to the given logger rather than
+// to stdout, from the start. The logger is mapped as a service, for the Logger middleware among others.
+func NewWithLogger(logger *log.Logger) *Martini {
+	m := &Martini{Injector: newInjector(), action: func() {}, logger: logger}
+	m.Map(m.logger)
 	m.Map(defaultReturnHandler()) //type ReturnHandler func(Context, []reflect.Value)，调用c.Next()陷入下一个中间件
 	return m
 }
@@ -51,17 +99,53 @@ func New() *Martini {
 // Will panic if any of the handlers is not a callable function
 // 设置所有的中间件
 func (m *Martini) Handlers(handlers ...Handler) {
-	m.handlers = make([]Handler, 0)
 	for _, handler := range handlers {
-		m.Use(handler)
+		m.validateHandler(handler)
 	}
+	stack := make([]Handler, len(handlers))
+	copy(stack, handlers)
+
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	m.handlers = stack
+}
+
+// GetHandlers returns a copy of the current middleware stack, in the order the handlers are invoked.
+func (m *Martini) GetHandlers() []Handler {
+	m.handlersLock.RLock()
+	defer m.handlersLock.RUnlock()
+	handlers := make([]Handler, len(m.handlers))
+	copy(handlers, m.handlers)
+	return handlers
 }
 
 // Action sets the handler that will be called after all the middleware has been invoked. This is set to martini.Router in a martini.Classic().
+// Several handlers make up a chain that is run like the handlers of a route: they may call Context.Next,
+// their return values are written by the ReturnHandler, and the chain stops once the response is written.
 // 设置真正的路由处理器，所有中间件执行完之后才会执行
-func (m *Martini) Action(handler Handler) {
-	validateHandler(handler)
-	m.action = handler
+func (m *Martini) Action(handlers ...Handler) {
+	for _, handler := range handlers {
+		m.validateHandler(handler)
+	}
+	action := Handler(func() {})
+	if len(handlers) == 1 {
+		action = handlers[0]
+	} else if len(handlers) > 1 {
+		action = chainHandlers(append([]Handler(nil), handlers...))
+	}
+
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	m.action = action
+}
+
+// chainHandlers returns a handler running the given handlers in turn, like the handlers of a route.
+func chainHandlers(handlers []Handler) Handler {
+	return func(c Context) {
+		context := &routeContext{c, 0, handlers}
+		c.MapTo(context, (*Context)(nil))
+		context.run()
+	}
 }
 
 // Logger sets the logger
@@ -71,35 +155,175 @@ func (m *Martini) Logger(logger *log.Logger) {
 }
 
 // Use adds a middleware Handler to the stack. Will panic if the handler is not a callable func. Middleware Handlers are invoked in the order that they are added.
+// The stack may be changed while serving requests: each request runs with the stack as it was when the request came in.
 // 添加一个中间件处理器，每一个http请求都会先执行，按照添加的顺序依次执行
 func (m *Martini) Use(handler Handler) {
-	validateHandler(handler)
-	m.handlers = append(m.handlers, handler)
+	m.validateHandler(handler)
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	// copy on write, requests in flight keep the stack they started with
+	handlers := make([]Handler, 0, len(m.handlers)+1)
+	handlers = append(handlers, m.handlers...)
+	m.handlers = append(handlers, handler)
+}
+
+// InsertHandler inserts a middleware Handler into the stack at the given index, shifting the handler at that
+// index and any after it back by one. An index equal to the stack length appends the handler, just like Use.
+// Will panic if the handler is not a callable func or if the index is out of range.
+func (m *Martini) InsertHandler(index int, handler Handler) {
+	m.validateHandler(handler)
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	validateHandlerIndex(index, len(m.handlers))
+	handlers := make([]Handler, 0, len(m.handlers)+1)
+	handlers = append(handlers, m.handlers[:index]...)
+	handlers = append(handlers, handler)
+	m.handlers = append(handlers, m.handlers[index:]...)
+}
+
+// RemoveHandler removes the middleware Handler at the given index from the stack.
+// Will panic if the index is out of range.
+func (m *Martini) RemoveHandler(index int) {
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	validateHandlerIndex(index, len(m.handlers)-1)
+	handlers := make([]Handler, 0, len(m.handlers)-1)
+	handlers = append(handlers, m.handlers[:index]...)
+	m.handlers = append(handlers, m.handlers[index+1:]...)
+}
+
+// ReplaceHandler replaces the middleware Handler at the given index with handler, keeping its position in the stack.
+// Will panic if the handler is not a callable func or if the index is out of range.
+func (m *Martini) ReplaceHandler(index int, handler Handler) {
+	m.validateHandler(handler)
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	validateHandlerIndex(index, len(m.handlers)-1)
+	handlers := make([]Handler, len(m.handlers))
+	copy(handlers, m.handlers)
+	handlers[index] = handler
+	m.handlers = handlers
 }
 
 // ServeHTTP is the HTTP Entry point for a Martini instance. Useful if you want to control your own HTTP server.
 // http接口，每一次http请求的用户级别处理的入口，会由 http.ListenAndServe(addr, inet) 回调调用。
 func (m *Martini) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	m.createContext(res, req).run() // 每一个请求创建一个上下文，保存一些必要的信息，之后开始处理请求
+	mounted, prefix, ok := m.mountRequest(req)
+	if !ok {
+		notFound(res, req)
+		return
+	}
+	c := m.acquireContext(res, mounted) // 每一个请求创建一个上下文，保存一些必要的信息，之后开始处理请求
+	defer releaseContext(c)
+	mapBasePath(c, prefix)
+	defer c.runDeferred()
+	c.run()
 }
 
 // Run the http server on a given host and port.
 // http 服务器启动
 func (m *Martini) RunOnAddr(addr string) {
-	// TODO: Should probably be implemented using a new instance of http.Server in place of
-	// calling http.ListenAndServer directly, so that it could be stored in the martini struct for later use.
-	// This would also allow to improve testing when a custom host and port are passed.
-
 	// 此处的 logger 和 Martini.Classic() 中的 m.Use(Logger()) 有所不同，
 	// 此处取出的 logger 创建于 martini.New() 中的 logger: log.New(os.Stdout, “[martini]”, 0)，
 	// 故会打印到标准输出，而 Martini.Classic() 中的 m.Use(Logger()) 是一个中间件。
-	logger := m.Injector.Get(reflect.TypeOf(m.logger)).Interface().(*log.Logger)
-	logger.Printf("listening on %s (%s)\n", addr, Env)
-	logger.Fatalln(http.ListenAndServe(addr, m))  // m是整个框架控制的核心，实现了 ServeHTTP 函数接口
+	m.serverLogger().Fatalln(m.RunServer(&http.Server{Addr: addr}))  // m是整个框架控制的核心，实现了 ServeHTTP 函数接口
+}
+
+// RunOnAddrTLS runs the https server on a given host and port, using the given certificate and key files.
+// An optional tls.Config can be passed to control cipher suites, minimum version and so on.
+func (m *Martini) RunOnAddrTLS(addr, certFile, keyFile string, config ...*tls.Config) {
+	server := &http.Server{Addr: addr, Handler: m}
+	if len(config) > 0 {
+		server.TLSConfig = config[0]
+	}
+	m.server.Store(server)
+
+	logger := m.serverLogger()
+	logger.Printf("listening on %s (TLS, %s)\n", addr, GetEnv())
+	logger.Fatalln(server.ListenAndServeTLS(certFile, keyFile))
 }
 
 // Run the http server. Listening on os.GetEnv("PORT") or 3000 by default.
 func (m *Martini) Run() {
+	m.RunOnAddr(defaultAddr())
+}
+
+// RunServer runs the given http.Server with the Martini instance as its Handler, so that timeouts,
+// header limits and the like can be tuned by the caller. The server is kept on the Martini instance
+// and can be retrieved with Server. The error returned by ListenAndServe is returned.
+func (m *Martini) RunServer(server *http.Server) error {
+	server.Handler = m
+	m.server.Store(server)
+	m.serverLogger().Printf("listening on %s (%s)\n", server.Addr, GetEnv())
+	return server.ListenAndServe()
+}
+
+// RunOnListener serves requests on the given net.Listener, such as one handed over by systemd socket activation
+// or one bound to a random port in tests. The error returned by Serve is returned.
+func (m *Martini) RunOnListener(l net.Listener) error {
+	server := &http.Server{Addr: l.Addr().String(), Handler: m}
+	m.server.Store(server)
+	m.serverLogger().Printf("listening on %s (%s)\n", server.Addr, GetEnv())
+	return server.Serve(l)
+}
+
+// Server returns the http.Server the Martini instance was last run with, or nil if it has not been run.
+func (m *Martini) Server() *http.Server {
+	server, _ := m.server.Load().(*http.Server)
+	return server
+}
+
+// RunWithShutdown runs the http server on addr until ctx is cancelled, then shuts it down gracefully,
+// waiting up to timeout for in-flight requests to finish (a zero timeout waits indefinitely).
+// An empty addr listens on the same address as Run. Unlike RunOnAddr, the error returned by
+// ListenAndServe or Shutdown is returned to the caller instead of being logged fatally.
+func (m *Martini) RunWithShutdown(ctx gocontext.Context, addr string, timeout time.Duration) error {
+	if len(addr) == 0 {
+		addr = defaultAddr()
+	}
+	server := &http.Server{Addr: addr}
+
+	done := make(chan struct{})
+	defer close(done)
+	shutdown := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		sctx := gocontext.Background()
+		if timeout > 0 {
+			var cancel gocontext.CancelFunc
+			sctx, cancel = gocontext.WithTimeout(sctx, timeout)
+			defer cancel()
+		}
+		shutdown <- server.Shutdown(sctx)
+	}()
+
+	if err := m.RunServer(server); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdown
+}
+
+// MappedTypes returns the types of the services mapped on the Martini instance, sorted by name. A debugging
+// route can list them, along with those mapped on the request, with Context.MappedTypes:
+//
+//	m.Get("/debug/services", func(c martini.Context) string {
+//		return fmt.Sprint(c.MappedTypes())
+//	})
+func (m *Martini) MappedTypes() []reflect.Type {
+	return mappedTypes(m.Injector)
+}
+
+// serverLogger returns the logger mapped on the injector, used for the server lifecycle messages.
+func (m *Martini) serverLogger() *log.Logger {
+	return m.Injector.Get(reflect.TypeOf(m.logger)).Interface().(*log.Logger)
+}
+
+// defaultAddr returns the address Run listens on: os.GetEnv("HOST") and os.GetEnv("PORT"), or :3000.
+func defaultAddr() string {
 	port := os.Getenv("PORT")
 	if len(port) == 0 {
 		port = "3000"
@@ -107,7 +331,7 @@ func (m *Martini) Run() {
 
 	host := os.Getenv("HOST")
 
-	m.RunOnAddr(host + ":" + port)
+	return host + ":" + port
 }
 
 
@@ -115,11 +339,47 @@ func (m *Martini) Run() {
 // 创建一个请求的上下文，与大部分的web框架一样，使用上下文的方式存储处理请求过程中的相关数据。
 func (m *Martini) createContext(res http.ResponseWriter, req *http.Request) *context {
 	// NewResponseWriter 对res进行了封装修饰，添加了一些其他功能，比如过滤器之类的。
-	c := &context{inject.New(), m.handlers, m.action, NewResponseWriter(res), 0}
+	return m.setupContext(&context{Injector: newInjector()}, NewResponseWriter(res), req)
+}
+
+// contextPool holds the contexts of the requests that have been handled, for acquireContext to reuse.
+var contextPool = sync.Pool{
+	New: func() interface{} {
+		return &context{Injector: newInjector()}
+	},
+}
+
+// acquireContext is like createContext, reusing a context and ResponseWriter from the pool. They must be
+// given back with releaseContext once the request has been handled.
+func (m *Martini) acquireContext(res http.ResponseWriter, req *http.Request) *context {
+	c := contextPool.Get().(*context)
+	rw, pooled := acquireResponseWriter(res)
+	c.pooledRW = pooled
+	return m.setupContext(c, rw, req)
+}
+
+// releaseContext resets c and puts it back in the pool.
+func releaseContext(c *context) {
+	releaseResponseWriter(c.pooledRW)
+	inj := c.Injector.(*recordingInjector)
+	inj.reset()
+	*c = context{Injector: inj}
+	contextPool.Put(c)
+}
+
+func (m *Martini) setupContext(c *context, rw ResponseWriter, req *http.Request) *context {
+	m.handlersLock.RLock()
+	c.handlers, c.action = m.handlers, m.action
+	m.handlersLock.RUnlock()
+	c.rw = rw
 	c.SetParent(m)
 	c.MapTo(c, (*Context)(nil))                      // Context 为接口类型，c 是实现了 Context 接口的具体类型结构体，以实现 接口类型 和 具体对象 的关联注入
 	c.MapTo(c.rw, (*http.ResponseWriter)(nil))       // http.ResponseWrite 同样为接口类型，c.rw 是实现了该接口的具体类型结构体，这里也做一种映射
 	c.Map(req) 										 // http.Request 是一种具体类型，这里则可以直接存储 req，无需做类型映射
+	if req != nil {
+		// the request's context.Context, cancelled when the client goes away
+		c.MapTo(req.Context(), (*gocontext.Context)(nil))
+	}
 	return c
 }
 
@@ -131,13 +391,46 @@ type ClassicMartini struct {
 }
 
 // Classic creates a classic Martini with some basic default middleware - martini.Logger, martini.Recovery and martini.Static.
-// Classic also maps martini.Routes as a service.
-func Classic() *ClassicMartini {
+// Classic also maps martini.Routes as a service. Options are passed on to New.
+func Classic(options ...Option) *ClassicMartini {
+	return ClassicWith(ClassicOptions{Logger: true, Recovery: true, Static: true, Options: options})
+}
+
+// ClassicOptions selects the default middleware ClassicWith adds.
+type ClassicOptions struct {
+	// Logger adds martini.Logger.
+	Logger bool
+	// Recovery adds martini.Recovery.
+	Recovery bool
+	// Static adds martini.Static, serving StaticDir.
+	Static bool
+	// StaticDir is the directory Static serves. Defaults to "public".
+	StaticDir string
+	// StaticOptions are passed on to martini.Static.
+	StaticOptions StaticOptions
+	// Options are passed on to New.
+	Options []Option
+}
+
+// ClassicWith creates a Martini like Classic, with only the default middleware turned on in opts:
+//
+//	m := martini.ClassicWith(martini.ClassicOptions{Logger: true, Recovery: true})
+func ClassicWith(opts ClassicOptions) *ClassicMartini {
 	r := NewRouter()                 // 基础路由器，用于存储用户自定义路由规则以及处理器
-	m := New()                       // 新建martini基础框架
-	m.Use(Logger())                  // 注册logger中间件，请求前后打印日志，需要类型有 res http.ResponseWriter, req *http.Request, c Context, log *log.Logger，调用c.Next()陷入下一个中间件。
-	m.Use(Recovery())                // 注册recover中间件，从各种panic中恢复回来并设置返回头和body
-	m.Use(Static("public"))          // 注册Static中间件，支持静态文件服务，执行完之后不陷入c.Next()，貌似是直接返回的，然后执行下个handle。
+	m := New(opts.Options...)        // 新建martini基础框架
+	if opts.Logger {
+		m.Use(Logger())              // 注册logger中间件，请求前后打印日志，需要类型有 res http.ResponseWriter, req *http.Request, c Context, log *log.Logger，调用c.Next()陷入下一个中间件。
+	}
+	if opts.Recovery {
+		m.Use(Recovery())            // 注册recover中间件，从各种panic中恢复回来并设置返回头和body
+	}
+	if opts.Static {
+		dir := opts.StaticDir
+		if dir == "" {
+			dir = "public"
+		}
+		m.Use(Static(dir, opts.StaticOptions)) // 注册Static中间件，支持静态文件服务，执行完之后不陷入c.Next()，貌似是直接返回的，然后执行下个handle。
+	}
 	m.MapTo(r, (*Routes)(nil))       // Injector的Mapto方法，实现类型和对象的关联注入，nil 表示这里只需要一个类型
 	m.Action(r.Handle)				 // 所有 router 中间件执行完才执行的 action 处理，相当于是正式的路由匹配处理，中间件做一些 web 常规必要的处理。
 	return &ClassicMartini{m, r}     // 返回一个ClassMartini实例，继承了Martini的结构，提升了martini以及Router的相关方法
@@ -150,12 +443,129 @@ type Handler interface{}
 
 // 检查Handler是否为函数类型
 func validateHandler(handler Handler) {
-	if reflect.TypeOf(handler).Kind() != reflect.Func {
+	t := reflect.TypeOf(handler)
+	if t == nil || t.Kind() != reflect.Func {
 		panic("martini handler must be a callable func")
 	}
+	// resolve the argument types now rather than on the first request
+	argTypes(t)
+}
+
+// abortDoneRequest aborts the chain of c if the request's context.Context is done, reporting whether it did.
+// A client that went away gets no response, but one still waiting past the deadline, such as set by Deadline,
+// gets a 503 rather than an empty 200.
+func abortDoneRequest(c Context) bool {
+	err := stdContext(c).Err()
+	if err == nil {
+		return false
+	}
+	if err == gocontext.DeadlineExceeded {
+		res := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil))).Interface().(http.ResponseWriter)
+		if !renderError(http.StatusServiceUnavailable, res) {
+			http.Error(res, "503 service unavailable", http.StatusServiceUnavailable)
+		}
+	}
+	c.Abort()
+	return true
+}
+
+// stdContext returns the context.Context mapped on c, or an empty one if there is none.
+func stdContext(c Context) gocontext.Context {
+	if rv := c.Get(inject.InterfaceOf((*gocontext.Context)(nil))); rv.IsValid() {
+		return rv.Interface().(gocontext.Context)
+	}
+	return gocontext.Background()
+}
+
+// mapStdContext maps ctx on c, along with a shallow copy of the request that carries it.
+func mapStdContext(c Context, ctx gocontext.Context) {
+	if req := c.Request(); req != nil {
+		c.Map(req.WithContext(ctx))
+	}
+	c.MapTo(ctx, (*gocontext.Context)(nil))
+}
+
+// invokeError is what the handler chain panics with when a handler can't be invoked, so NextE can tell
+// it apart from the panics of the handlers themselves.
+type invokeError struct {
+	err error
+}
+
+func (e invokeError) Error() string {
+	return e.err.Error()
+}
+
+// IsInvokeError reports whether a value recovered from a panic of the handler chain means a handler could not be
+// invoked, such as for a service missing from the injector, rather than that a handler panicked itself. It lets a
+// RecoveryOptions.Reporter tell setup mistakes apart from crashes. The errors handlers return never panic.
+func IsInvokeError(err interface{}) bool {
+	_, ok := err.(invokeError)
+	return ok
+}
+
+func newInvokeError(err error, handler Handler) invokeError {
+	return invokeError{fmt.Errorf("martini: %v, while invoking handler %s", err, handlerName(handler))}
+}
+
+// newChainInvokeError is newInvokeError for the handler at index in a chain of count handlers. As services are
+// only mapped for the handlers that follow the one mapping them, a missing service most often comes from a
+// middleware added after the handler needing it, which the message hints at.
+func newChainInvokeError(err error, handler Handler, index, count int, chain string) invokeError {
+	msg := fmt.Sprintf("martini: %v, while invoking handler %s (%d of %d %s)", err, handlerName(handler), index+1, count, chain)
+	if missing, ok := err.(missingValueError); ok && index+1 < count {
+		msg += fmt.Sprintf("; no handler before it mapped a %v, if one of the %d after it does, move that one before it",
+			missing.typ, count-index-1)
+	}
+	return invokeError{errors.New(msg)}
+}
+
+// handlerName returns the name of the handler's function, for error messages.
+func handlerName(handler Handler) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); f != nil {
+		return f.Name()
+	}
+	return reflect.TypeOf(handler).String()
+}
+
+// mustGet returns the value mapped for t on the injector, panicking if there is none.
+func mustGet(inj inject.Injector, t reflect.Type) interface{} {
+	rv := inj.Get(t)
+	if !rv.IsValid() {
+		panic(fmt.Sprintf("martini: no value mapped for type %v", t))
+	}
+	return rv.Interface()
+}
+
+// catchInvokeError calls next, returning the error it panics with if a handler can't be invoked.
+func catchInvokeError(next func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ie, ok := r.(invokeError)
+			if !ok {
+				panic(r)
+			}
+			err = ie.err
+		}
+	}()
+	next()
+	return nil
+}
+
+// 检查中间件索引是否在 [0, max] 范围内
+func validateHandlerIndex(index, max int) {
+	if index < 0 || index > max {
+		panic(fmt.Sprintf("martini handler index %d out of range [0, %d]", index, max))
+	}
 }
 
 // Context represents a request context. Services can be mapped on the request level from this interface.
+//
+// Mapping and getting services is safe for concurrent use, so a handler may fan work out to goroutines that
+// map or get services on its Context. The other methods drive the handler chain and the response, they must
+// only be called from the handler's own goroutine, and the goroutines must be done before the handler returns.
+//
+// Martini reuses the Context of a request, along with its ResponseWriter, for later requests once the request
+// has been handled: neither may be kept, or used, after the handler chain has returned.
 type Context interface {
 
 	// 包含了另一个接口类型的所有接口，Context的实例必须实现所有的接口，或者包含一个匿名的具体事例实现该所有接口。
@@ -164,13 +574,113 @@ type Context interface {
 	// Next is an optional function that Middleware Handlers can call to yield the until after
 	// the other Handlers have been executed. This works really well for any operations that must
 	// happen after an http request
-
+	//
+	// The chain stops as soon as the response is written, or once the request's context.Context is done,
+	// such as when the client disconnects; middleware can tell the latter by checking the context's Err.
 	// 中间件的顺序执行过程中按顺序执行时，使用Next接口不断的更新索引指向下一个中间件
 	Next()
 
+	// NextE is like Next, but returns the error a handler further down the chain could not be invoked with,
+	// such as a service missing from the injector, instead of panicking with it.
+	NextE() error
+
+	// RunFrom runs the chain again from the handler at index, such as for middleware that replays the rest of
+	// the chain after refreshing a credential. The index counts from 0 in the chain the Context runs: the
+	// middleware stack followed by the action, or the handlers of the route. Like Next it returns once the
+	// chain is done. It panics if index is out of range. Nothing runs if the response has been written already,
+	// since a response that went out can't be taken back: a replay needs the first run to stop before writing.
+	RunFrom(index int)
+
+	// HandlerIndex returns the index of the handler being run in the chain the Context runs, counted like for
+	// RunFrom. Once the handler called Next it points past the handlers that ran since.
+	HandlerIndex() int
+
+	// HandlerCount returns the number of handlers in the chain the Context runs: the middleware stack and the
+	// action, or the handlers of the route.
+	HandlerCount() int
+
 	// Written returns whether or not the response for this context has been written.
 	// 返回是否 http 请求已经处理完并发送应答的标识
 	Written() bool
+
+	// Abort stops the remaining handlers from being invoked, without writing a response.
+	// Handlers that are waiting on Next still resume once it returns.
+	Abort()
+
+	// AbortWithStatus writes the given status code to the response and stops the remaining handlers from being invoked.
+	AbortWithStatus(int)
+
+	// Redirect redirects the request to location with the given status, 302 Found by default, which writes the response.
+	Redirect(location string, status ...int)
+
+	// SetHeader sets the response header key to value, replacing any values it had. A header set once the
+	// response is written doesn't make it into the response, which is logged as a warning.
+	SetHeader(key, value string)
+
+	// AddHeader adds value to the values of the response header key, like SetHeader.
+	AddHeader(key, value string)
+
+	// ClientIP returns the IP address of the client that made the request, see ClientIP.
+	ClientIP() string
+
+	// Push pushes the target, such as a stylesheet the page needs, with HTTP/2 server push. It returns
+	// http.ErrNotSupported if the response can't push, such as over HTTP/1.1.
+	Push(target string, opts *http.PushOptions) error
+
+	// Request returns the *http.Request mapped on the context.
+	Request() *http.Request
+
+	// ResponseWriter returns the ResponseWriter mapped on the context, falling back to the one Martini wrapped
+	// the response in if the mapped http.ResponseWriter is not a martini.ResponseWriter.
+	ResponseWriter() ResponseWriter
+
+	// WithValue derives the request's context.Context with the given key and value, and maps it along with
+	// a copy of the *http.Request carrying it, so that the handlers invoked afterwards can read the value.
+	WithValue(key, val interface{})
+
+	// Defer registers a function to be called once the request has been handled, even if a handler panicked.
+	// Deferred functions are called in the reverse order they were registered, like deferred calls in Go.
+	Defer(func())
+
+	// SetSecureCookie sets a cookie whose value is signed, and encrypted if configured, with the mapped
+	// SecureCookieKeys. Panics if SecureCookieKeys is not mapped.
+	SetSecureCookie(name, value string, opts CookieOptions)
+
+	// SecureCookie returns the value of a cookie set with SetSecureCookie. It returns false if the cookie is
+	// missing, has been tampered with or has expired. Panics if SecureCookieKeys is not mapped.
+	SecureCookie(name string) (string, bool)
+
+	// MustGet returns the value mapped for the given type, panicking with a message naming the type if there is none.
+	MustGet(reflect.Type) interface{}
+
+	// MapWithCleanup maps the value like Map, and registers cleanup to be called once the request has been
+	// handled, even if a handler panicked, such as a rollback for a per-request transaction that was not committed.
+	MapWithCleanup(val interface{}, cleanup func())
+
+	// MapFactory maps a function building a service, the type of its first result, for the rest of the request.
+	// The function is only called the first time the service is needed, with its arguments injected, so an
+	// expensive service such as a database transaction is only created for the requests that use it. It may
+	// return an error as well, which is panicked with. The factory is only used for the exact type it returns.
+	MapFactory(fn interface{})
+
+	// MappedTypes returns the types mapped on the request, along with those mapped on the Martini instance,
+	// sorted by name. It helps finding out why a handler's argument could not be injected.
+	MappedTypes() []reflect.Type
+
+	// Query returns the first value of the given URL query parameter, or "" if it is not present.
+	Query(key string) string
+
+	// QueryInt returns the given URL query parameter as an int, or def if it is missing or not a number.
+	QueryInt(key string, def int) int
+
+	// Accepts returns the content type among offers, such as "application/json" or "text/html", that the request's
+	// Accept header prefers, honouring quality values and wildcards. It returns "" if none of them is acceptable, and
+	// the first offer if the request has no Accept header.
+	Accepts(offers ...string) string
+
+	// Param returns the value of the given named route parameter, such as "id" for "/users/:id", or "" if
+	// the route has no such parameter.
+	Param(key string) string
 }
 
 
@@ -187,6 +697,10 @@ type context struct {
 	rw       ResponseWriter
 	// 表示当前第n个hanlder的索引
 	index    int
+	// functions registered through Defer, run once the request has been handled
+	deferred []func()
+	// the pooled wrapper rw is, for contexts from acquireContext
+	pooledRW *closeNotifyResponseWriter
 }
 
 
@@ -209,21 +723,195 @@ func (c *context) Next() {
 	c.run()
 }
 
+func (c *context) RunFrom(index int) {
+	validateHandlerIndex(index, len(c.handlers))
+	if c.Written() {
+		return
+	}
+	c.index = index
+	c.run()
+}
+
+func (c *context) HandlerIndex() int {
+	return c.index
+}
+
+func (c *context) HandlerCount() int {
+	return len(c.handlers) + 1
+}
+
 // 判断是否已发送应答，若已发送，则不需要再进行处理
+func (c *context) NextE() error {
+	return catchInvokeError(c.Next)
+}
+
 func (c *context) Written() bool {
-	return c.rw.Written()
+	// ask the mapped writer, middleware may have wrapped the response since
+	return c.ResponseWriter().Written()
+}
+
+// 将索引移到 action 之后，run 的循环随之结束
+func (c *context) Abort() {
+	c.index = len(c.handlers) + 1
+}
+
+func (c *context) Request() *http.Request {
+	rv := c.Get(reflect.TypeOf((*http.Request)(nil)))
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface().(*http.Request)
+}
+
+func (c *context) ResponseWriter() ResponseWriter {
+	rv := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+	if rv.IsValid() {
+		if rw, ok := rv.Interface().(ResponseWriter); ok {
+			return rw
+		}
+	}
+	return c.rw
+}
+
+func (c *context) WithValue(key, val interface{}) {
+	mapStdContext(c, gocontext.WithValue(stdContext(c), key, val))
+}
+
+func (c *context) Query(key string) string {
+	req := c.Request()
+	if req == nil {
+		return ""
+	}
+	return req.URL.Query().Get(key)
+}
+
+func (c *context) QueryInt(key string, def int) int {
+	n, err := strconv.Atoi(c.Query(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func (c *context) Accepts(offers ...string) string {
+	req := c.Request()
+	if req == nil {
+		return negotiate("", offers)
+	}
+	return negotiate(req.Header.Get("Accept"), offers)
+}
+
+func (c *context) Param(key string) string {
+	rv := c.Get(reflect.TypeOf(Params(nil)))
+	if !rv.IsValid() {
+		return ""
+	}
+	return rv.Interface().(Params)[key]
+}
+
+func (c *context) Defer(fn func()) {
+	c.deferred = append(c.deferred, fn)
+}
+
+func (c *context) MustGet(t reflect.Type) interface{} {
+	return mustGet(c, t)
+}
+
+func (c *context) MapWithCleanup(val interface{}, cleanup func()) {
+	c.Map(val)
+	c.Defer(cleanup)
+}
+
+func (c *context) MapFactory(fn interface{}) {
+	c.Injector.(*recordingInjector).mapFactory(fn)
+}
+
+func (c *context) MappedTypes() []reflect.Type {
+	return mappedTypes(c.Injector)
+}
+
+// 按注册的逆序调用 Defer 注册的函数
+func (c *context) runDeferred() {
+	for i := len(c.deferred) - 1; i >= 0; i-- {
+		c.deferred[i]()
+	}
+	c.deferred = nil
+}
+
+func (c *context) Redirect(location string, status ...int) {
+	code := http.StatusFound
+	if len(status) > 0 {
+		code = status[0]
+	}
+	rv := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+	res := rv.Interface().(http.ResponseWriter)
+	if req := c.Request(); req != nil {
+		http.Redirect(res, req, withBasePath(c, req, location), code)
+		return
+	}
+	res.Header().Set("Location", location)
+	res.WriteHeader(code)
+}
+
+func (c *context) SetHeader(key, value string) {
+	c.responseHeader("SetHeader", key).Set(key, value)
+}
+
+func (c *context) AddHeader(key, value string) {
+	c.responseHeader("AddHeader", key).Add(key, value)
+}
+
+// responseHeader returns the header map of the mapped http.ResponseWriter, warning that the header key won't be
+// sent if the response has been written already.
+func (c *context) responseHeader(method, key string) http.Header {
+	if c.Written() {
+		if rv := c.Get(reflect.TypeOf((*log.Logger)(nil))); rv.IsValid() {
+			rv.Interface().(*log.Logger).Printf("WARNING: %s(%q) called after the response was written, the header is not sent\n", method, key)
+		}
+	}
+	rv := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+	return rv.Interface().(http.ResponseWriter).Header()
+}
+
+func (c *context) ClientIP() string {
+	req := c.Request()
+	if req == nil {
+		return ""
+	}
+	return ClientIP(req)
+}
+
+func (c *context) Push(target string, opts *http.PushOptions) error {
+	rv := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+	if pusher, ok := rv.Interface().(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	// a middleware wrapping the response may not pass Push through, the ResponseWriter of Martini does
+	if pusher, ok := c.rw.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (c *context) AbortWithStatus(status int) {
+	rv := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+	rv.Interface().(http.ResponseWriter).WriteHeader(status)
+	c.Abort()
 }
 
 func (c *context) run() {
 	// 循环调用，直到有 handler/action 的返回 error 引发 panic，或者有往 ResponseWriter() 输出结果的，则结束循环，直接返回。
 	for c.index <= len(c.handlers) {  
-		_, err := c.Invoke(c.handler())     // c.Invoke 对当前 c.handler() 函数进行回调，函数参数此前已由 injector 注入，返回值存储在 c 中。
+		_, err := invoke(c, c.handler())     // c.Invoke 对当前 c.handler() 函数进行回调，函数参数此前已由 injector 注入，返回值存储在 c 中。
 		if err != nil {
-			panic(err)
+			panic(newChainInvokeError(err, c.handler(), c.index, len(c.handlers)+1, "in the middleware stack"))
 		}
 		c.index += 1 						// for 循环先通过 c.Invoke() 反射调用处理函数，再更新索引，因此与 c.Next() 中的更新索引 index 并不冲突。
 		if c.Written() {
 			return
 		}
+		if abortDoneRequest(c) {
+			return
+		}
 	}
 }
@@ -1,10 +1,18 @@
 package martini
 
 import (
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 /* Test Helpers */
@@ -27,6 +35,60 @@ func Test_New(t *testing.T) {
 	}
 }
 
+type testCache interface {
+	Get(key string) string
+}
+
+type mapCache map[string]string
+
+func (c mapCache) Get(key string) string {
+	return c[key]
+}
+
+func Test_New_Options(t *testing.T) {
+	m := Classic(WithService("a service"), WithServiceTo(mapCache{"foo": "bar"}, (*testCache)(nil)))
+	m.Get("/", func(s string, cache testCache) string {
+		return s + " " + cache.Get("foo")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "a service bar")
+}
+
+func Test_ClassicWith(t *testing.T) {
+	expect(t, len(Classic().GetHandlers()), 3)
+	expect(t, len(ClassicWith(ClassicOptions{}).GetHandlers()), 0)
+
+	m := ClassicWith(ClassicOptions{Logger: true, Recovery: true, Options: []Option{WithService(log.New(bytes.NewBuffer(nil), "", 0))}})
+	expect(t, len(m.GetHandlers()), 2)
+	m.Get("/panic", func() {
+		panic("here")
+	})
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/panic", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+
+	m = ClassicWith(ClassicOptions{Static: true, StaticDir: ".", StaticOptions: StaticOptions{Prefix: "/files"}})
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/files/martini.go", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+}
+
+func Test_NewWithLogger(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	m := NewWithLogger(log.New(buff, "[app] ", 0))
+	m.Use(Logger())
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, strings.HasPrefix(buff.String(), "[app] Started GET /foo"), true)
+}
+
 func Test_Martini_RunOnAddr(t *testing.T) {
 	// just test that Run doesn't bomb
 	go New().RunOnAddr("127.0.0.1:8080")
@@ -36,6 +98,65 @@ func Test_Martini_Run(t *testing.T) {
 	go New().Run()
 }
 
+func Test_Martini_RunWithShutdown(t *testing.T) {
+	m := New()
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- m.RunWithShutdown(ctx, "127.0.0.1:0", time.Second)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		expect(t, err, nil)
+	case <-time.After(2 * time.Second):
+		t.Error("RunWithShutdown did not return after the context was cancelled")
+	}
+}
+
+func Test_Martini_RunServer(t *testing.T) {
+	m := New()
+	// an invalid address makes ListenAndServe return straight away
+	server := &http.Server{Addr: "127.0.0.1:-1", ReadTimeout: time.Second}
+	err := m.RunServer(server)
+
+	refute(t, err, nil)
+	expect(t, m.Server(), server)
+	expect(t, server.Handler, http.Handler(m))
+}
+
+func Test_Martini_RunOnListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := New()
+	m.Use(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusTeapot)
+	})
+	expect(t, m.Server() == nil, true)
+	served := make(chan error, 1)
+	go func() {
+		served <- m.RunOnListener(l)
+	}()
+
+	res, err := http.Get("http://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	expect(t, res.StatusCode, http.StatusTeapot)
+	// read while the server goroutine runs, such as for a shutdown
+	expect(t, m.Server().Addr, l.Addr().String())
+
+	l.Close()
+	refute(t, <-served, nil)
+}
+
 func Test_Martini_ServeHTTP(t *testing.T) {
 	result := ""
 	response := httptest.NewRecorder()
@@ -92,6 +213,127 @@ func Test_Martini_Handlers(t *testing.T) {
 	expect(t, response.Code, http.StatusBadRequest)
 }
 
+func Test_Martini_ActionChain(t *testing.T) {
+	result := ""
+	m := New()
+	m.Use(func() {
+		result += "foo"
+	})
+	m.Action(func(c Context) {
+		result += "bar"
+		c.Next()
+		result += "ban"
+	}, func() string {
+		result += "baz"
+		return "hello"
+	}, func() {
+		result += "not reached"
+	})
+
+	response := httptest.NewRecorder()
+	m.ServeHTTP(response, (*http.Request)(nil))
+	expect(t, result, "foobarbazban")
+	expect(t, response.Body.String(), "hello")
+}
+
+func Test_Martini_GetHandlers(t *testing.T) {
+	m := New()
+	expect(t, len(m.GetHandlers()), 0)
+
+	m.Use(func() {})
+	m.Use(func(c Context) {})
+	handlers := m.GetHandlers()
+	expect(t, len(handlers), 2)
+
+	// the returned slice is a copy
+	handlers[0] = nil
+	refute(t, m.GetHandlers()[0], nil)
+}
+
+func Test_Martini_InsertHandler(t *testing.T) {
+	result := ""
+	response := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func() {
+		result += "foo"
+	})
+	m.Use(func() {
+		result += "bat"
+	})
+	m.InsertHandler(1, func() {
+		result += "bar"
+	})
+	m.InsertHandler(0, func() {
+		result += "ban"
+	})
+	m.InsertHandler(4, func() {
+		result += "baz"
+	})
+
+	m.ServeHTTP(response, (*http.Request)(nil))
+	expect(t, result, "banfoobarbatbaz")
+}
+
+func Test_Martini_InsertHandler_OutOfRange(t *testing.T) {
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+
+	m := New()
+	m.InsertHandler(1, func() {})
+}
+
+func Test_Martini_RemoveHandler(t *testing.T) {
+	result := ""
+	response := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func() {
+		result += "foo"
+	})
+	m.Use(func() {
+		result += "bar"
+	})
+	m.Use(func() {
+		result += "bat"
+	})
+	m.RemoveHandler(1)
+
+	m.ServeHTTP(response, (*http.Request)(nil))
+	expect(t, result, "foobat")
+	expect(t, len(m.GetHandlers()), 2)
+}
+
+func Test_Martini_ReplaceHandler(t *testing.T) {
+	result := ""
+	response := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func() {
+		result += "foo"
+	})
+	m.Use(func() {
+		result += "bar"
+	})
+	m.ReplaceHandler(0, func() {
+		result += "baz"
+	})
+
+	m.ServeHTTP(response, (*http.Request)(nil))
+	expect(t, result, "bazbar")
+}
+
+func Test_Martini_RemoveHandler_OutOfRange(t *testing.T) {
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+
+	m := New()
+	m.Use(func() {})
+	m.RemoveHandler(1)
+}
+
 func Test_Martini_EarlyWrite(t *testing.T) {
 	result := ""
 	response := httptest.NewRecorder()
@@ -115,6 +357,306 @@ func Test_Martini_EarlyWrite(t *testing.T) {
 	expect(t, response.Code, http.StatusOK)
 }
 
+func Test_Martini_Abort(t *testing.T) {
+	result := ""
+	response := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func(c Context) {
+		result += "foo"
+		c.Next()
+		result += "ban"
+	})
+	m.Use(func(c Context) {
+		result += "bar"
+		c.Abort()
+	})
+	m.Use(func() {
+		result += "bat"
+	})
+	m.Action(func() {
+		result += "baz"
+	})
+
+	m.ServeHTTP(response, (*http.Request)(nil))
+
+	expect(t, result, "foobarban")
+	expect(t, response.Code, http.StatusOK)
+}
+
+func Test_Martini_AbortWithStatus(t *testing.T) {
+	result := ""
+	response := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func(c Context) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+	m.Action(func() {
+		result += "baz"
+	})
+
+	m.ServeHTTP(response, (*http.Request)(nil))
+
+	expect(t, result, "")
+	expect(t, response.Code, http.StatusUnauthorized)
+}
+
+func Test_Martini_Redirect(t *testing.T) {
+	result := ""
+	m := New()
+	m.Use(func(c Context, req *http.Request) {
+		if req.URL.Path == "/moved" {
+			c.Redirect("/new", http.StatusMovedPermanently)
+		} else {
+			c.Redirect("/login")
+		}
+		// a second write is ignored
+		c.ResponseWriter().WriteHeader(http.StatusOK)
+	})
+	m.Action(func() {
+		result += "baz"
+	})
+
+	response := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/account", nil)
+	m.ServeHTTP(response, req)
+	expect(t, result, "")
+	expect(t, response.Code, http.StatusFound)
+	expect(t, response.Header().Get("Location"), "/login")
+
+	response = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/moved", nil)
+	m.ServeHTTP(response, req)
+	expect(t, response.Code, http.StatusMovedPermanently)
+	expect(t, response.Header().Get("Location"), "/new")
+}
+
+func Test_Martini_SetHeader(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	m := New()
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(func(c Context) {
+		c.SetHeader("Content-Type", "text/plain")
+		c.SetHeader("X-Test", "replaced")
+		c.SetHeader("X-Test", "a")
+		c.AddHeader("X-Test", "b")
+		c.Next()
+		c.SetHeader("X-Late", "too late")
+	})
+	m.Action(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusOK)
+	})
+
+	response := httptest.NewRecorder()
+	m.ServeHTTP(response, (*http.Request)(nil))
+	expect(t, response.Header().Get("Content-Type"), "text/plain")
+	expect(t, strings.Join(response.Header()["X-Test"], ","), "a,b")
+	expect(t, buff.String(), "[martini] WARNING: SetHeader(\"X-Late\") called after the response was written, the header is not sent\n")
+}
+
+func Test_Martini_Push(t *testing.T) {
+	var err error
+	m := New()
+	m.Use(func(c Context) {
+		err = c.Push("/app.css", nil)
+	})
+
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+	expect(t, err, http.ErrNotSupported)
+}
+
+func Test_Martini_PushBehindGzip(t *testing.T) {
+	var err error
+	m := New()
+	m.Use(Gzip())
+	m.Use(func(c Context) {
+		err = c.Push("/app.css", nil)
+	})
+
+	pushable := &pushableResponse{ResponseRecorder: httptest.NewRecorder()}
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	m.ServeHTTP(pushable, req)
+	expect(t, err, nil)
+	expect(t, len(pushable.pushed), 1)
+}
+
+func Test_Martini_RunFrom(t *testing.T) {
+	result := ""
+	refreshed := false
+	m := New()
+	m.Use(func(c Context) {
+		result += "foo"
+		c.Next()
+		if !c.Written() && !refreshed {
+			// replay the rest of the chain once the token is refreshed
+			refreshed = true
+			c.RunFrom(1)
+		}
+	})
+	m.Use(func(c Context, res http.ResponseWriter) {
+		result += "bar"
+		if refreshed {
+			res.WriteHeader(http.StatusOK)
+		}
+	})
+	m.Action(func() {
+		result += "baz"
+	})
+
+	response := httptest.NewRecorder()
+	m.ServeHTTP(response, (*http.Request)(nil))
+	expect(t, result, "foobarbazbar")
+}
+
+func Test_Martini_HandlerIndex(t *testing.T) {
+	stages := []string{}
+	stage := func(c Context) {
+		stages = append(stages, fmt.Sprintf("%d/%d", c.HandlerIndex()+1, c.HandlerCount()))
+	}
+	m := New()
+	m.Use(stage)
+	m.Use(stage)
+	m.Action(stage)
+
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+	expect(t, strings.Join(stages, " "), "1/3 2/3 3/3")
+}
+
+func Test_Martini_RunFrom_OutOfRange(t *testing.T) {
+	m := New()
+	m.Use(func(c Context) {
+		defer func() {
+			recover()
+		}()
+		c.RunFrom(2)
+		t.Error("RunFrom should panic")
+	})
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+}
+
+func Test_Martini_Defer(t *testing.T) {
+	result := ""
+	response := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func(c Context) {
+		c.Defer(func() {
+			result += "ban"
+		})
+		c.Defer(func() {
+			result += "bat"
+		})
+		c.Next()
+		result += "never"
+	})
+	m.Action(func() {
+		result += "foo"
+		panic("here is a panic!")
+	})
+
+	func() {
+		defer func() {
+			refute(t, recover(), nil)
+		}()
+		m.ServeHTTP(response, (*http.Request)(nil))
+	}()
+
+	expect(t, result, "foobatban")
+}
+
+type testTx struct {
+	committed, rolledBack bool
+}
+
+func Test_Martini_MapWithCleanup(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		tx := &testTx{}
+		m := New()
+		m.Use(Recovery())
+		m.Use(func(c Context) {
+			c.MapWithCleanup(tx, func() {
+				if !tx.committed {
+					tx.rolledBack = true
+				}
+			})
+		})
+		m.Use(func(tx *testTx) {
+			if fail {
+				panic("here is a panic!")
+			}
+			tx.committed = true
+		})
+
+		m.Map(log.New(bytes.NewBufferString(""), "", 0))
+		m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+		expect(t, tx.committed, !fail)
+		expect(t, tx.rolledBack, fail)
+	}
+}
+
+func Test_Martini_RequestAndResponseWriter(t *testing.T) {
+	response := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo", nil)
+
+	m := New()
+	m.Use(func(c Context) {
+		expect(t, c.Request(), req)
+		c.ResponseWriter().WriteHeader(http.StatusTeapot)
+		expect(t, c.ResponseWriter().Status(), http.StatusTeapot)
+	})
+
+	m.ServeHTTP(response, req)
+	expect(t, response.Code, http.StatusTeapot)
+}
+
+func Test_Martini_StdContext(t *testing.T) {
+	type key string
+	response := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo", nil)
+	ctx, cancel := gocontext.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+
+	m := New()
+	m.Use(func(c Context, ctx gocontext.Context) {
+		expect(t, ctx, req.Context())
+		c.WithValue(key("user"), "jeremy")
+	})
+	m.Use(func(ctx gocontext.Context, r *http.Request) {
+		expect(t, ctx.Value(key("user")), "jeremy")
+		expect(t, r.Context(), ctx)
+		cancel()
+		expect(t, ctx.Err(), gocontext.Canceled)
+	})
+
+	m.ServeHTTP(response, req)
+}
+
+func Test_Martini_QueryAndParam(t *testing.T) {
+	response := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users/42?name=jeremy&page=3&size=big", nil)
+
+	m := Classic()
+	m.Get("/users/:id", func(c Context) {
+		expect(t, c.Param("id"), "42")
+		expect(t, c.Param("missing"), "")
+		expect(t, c.Query("name"), "jeremy")
+		expect(t, c.Query("missing"), "")
+		expect(t, c.QueryInt("page", 1), 3)
+		expect(t, c.QueryInt("size", 10), 10)
+		expect(t, c.QueryInt("missing", 10), 10)
+		c.ResponseWriter().WriteHeader(http.StatusOK)
+	})
+
+	m.ServeHTTP(response, req)
+	expect(t, response.Code, http.StatusOK)
+
+	// outside of a route there are no params
+	ctx := m.createContext(response, req)
+	expect(t, ctx.Param("id"), "")
+}
+
 func Test_Martini_Written(t *testing.T) {
 	response := httptest.NewRecorder()
 
@@ -143,3 +685,172 @@ func Test_Martini_Basic_NoRace(t *testing.T) {
 		}()
 	}
 }
+
+func Test_Martini_Use_WhileServing(t *testing.T) {
+	m := New()
+	m.Use(func() {})
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		go func() {
+			defer wg.Done()
+			m.Use(func() {})
+			m.Action(func() {})
+		}()
+	}
+	wg.Wait()
+	expect(t, len(m.GetHandlers()), 11)
+}
+
+func Test_Martini_NextE(t *testing.T) {
+	response := httptest.NewRecorder()
+
+	m := New()
+	var nextErr error
+	m.Use(func(c Context, res http.ResponseWriter) {
+		nextErr = c.NextE()
+		res.WriteHeader(http.StatusBadGateway)
+	})
+	m.Use(func(c Context) {
+		c.Next()
+	})
+	m.Use(func(s string) {
+		// string is not mapped
+	})
+
+	m.ServeHTTP(response, (*http.Request)(nil))
+	refute(t, nextErr, nil)
+	expect(t, response.Code, http.StatusBadGateway)
+
+	// without NextE the chain still panics
+	m = New()
+	m.Use(func(s string) {})
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+}
+
+func Test_Martini_MustGet(t *testing.T) {
+	m := New()
+	m.Use(func(c Context) {
+		expect(t, c.MustGet(reflect.TypeOf("")), "foo")
+	})
+	m.Map("foo")
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+
+	m = New()
+	m.Use(func(c Context) {
+		defer func() {
+			expect(t, recover(), "martini: no value mapped for type int")
+		}()
+		c.MustGet(reflect.TypeOf(0))
+	})
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+}
+
+func missingServiceHandler(s []string) {}
+
+func Test_Martini_InvokeErrorNamesHandler(t *testing.T) {
+	m := New()
+	var err error
+	m.Use(func(c Context) {
+		err = c.NextE()
+	})
+	m.Use(missingServiceHandler)
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "[]string"), true)
+	expect(t, strings.Contains(err.Error(), "while invoking handler github.com/go-martini/martini.missingServiceHandler (2 of 3 in the middleware stack)"), true)
+}
+
+func Test_Martini_InvokeErrorSuggestsReordering(t *testing.T) {
+	m := New()
+	var err error
+	m.Use(func(c Context) {
+		err = c.NextE()
+	})
+	m.Use(func(s []string) {})
+	m.Use(func(c Context) {
+		c.Map([]string{"mapped too late"})
+	})
+	m.ServeHTTP(httptest.NewRecorder(), (*http.Request)(nil))
+
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "(2 of 4 in the middleware stack)"), true)
+	expect(t, strings.HasSuffix(err.Error(), "no handler before it mapped a []string, if one of the 2 after it does, move that one before it"), true)
+}
+
+func Test_Martini_CancelledRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	ctx, cancel := gocontext.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+
+	result := ""
+	m := Classic()
+	m.Use(func(c Context, ctx gocontext.Context) {
+		result += "foo"
+		c.Next()
+		expect(t, ctx.Err(), gocontext.Canceled)
+	})
+	m.Use(func() {
+		result += "bar"
+		// the client goes away
+		cancel()
+	})
+	m.Use(func() {
+		result += "baz"
+	})
+	m.Get("/", func() string {
+		result += "bat"
+		return "hello"
+	})
+
+	response := httptest.NewRecorder()
+	m.ServeHTTP(response, req)
+	expect(t, result, "foobar")
+	expect(t, response.Body.String(), "")
+}
+
+func benchmarkMartini() *Martini {
+	m := New()
+	m.Use(func(c Context) {
+		c.Next()
+	})
+	m.Action(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusOK)
+	})
+	return m
+}
+
+func Benchmark_Martini_ServeHTTP(b *testing.B) {
+	m := benchmarkMartini()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	res := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.ServeHTTP(res, req)
+	}
+}
+
+// Benchmark_Martini_ServeHTTP_Unpooled handles the requests the way ServeHTTP does, without reusing the contexts.
+func Benchmark_Martini_ServeHTTP_Unpooled(b *testing.B) {
+	m := benchmarkMartini()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	res := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := m.createContext(res, req)
+		c.run()
+		c.runDeferred()
+	}
+}
@@ -0,0 +1,47 @@
+package martini
+
+import (
+	"reflect"
+
+	"github.com/codegangsta/inject"
+)
+
+// Named holds values mapped by name rather than by type. The injector maps a single value per type, so
+// middleware that map two values of the same type (a user ID and a request ID, both strings) clobber each
+// other; mapping them by name with MapNamed keeps both. Handlers request Named like any other service:
+//
+//	m.Use(func(c martini.Context) {
+//	  martini.MapNamed(c, "user_id", "42")
+//	})
+//
+//	m.Get("/", func(n martini.Named) string {
+//	  return n.String("user_id")
+//	})
+//
+// Declaring a distinct type for the value (type UserID string) and mapping it with Map works just as well.
+type Named map[string]interface{}
+
+// MapNamed maps value under name on the given injector, usually a Context or a Martini instance.
+// Values mapped on a request context never leak into the ones mapped on the Martini instance.
+func MapNamed(inj inject.TypeMapper, name string, value interface{}) {
+	named := Named{}
+	// copy what is already visible, which may come from the parent injector
+	if rv := inj.Get(reflect.TypeOf(named)); rv.IsValid() {
+		for k, v := range rv.Interface().(Named) {
+			named[k] = v
+		}
+	}
+	named[name] = value
+	inj.Map(named)
+}
+
+// Get returns the value mapped under name, or nil if there is none.
+func (n Named) Get(name string) interface{} {
+	return n[name]
+}
+
+// String returns the string mapped under name, or an empty string if there is none or it is not a string.
+func (n Named) String(name string) string {
+	s, _ := n[name].(string)
+	return s
+}
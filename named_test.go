@@ -0,0 +1,32 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_MapNamed(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	MapNamed(m, "app", "martini")
+	m.Use(func(c Context) {
+		MapNamed(c, "user_id", "42")
+		MapNamed(c, "request_id", "abc")
+	})
+	m.Use(func(n Named) {
+		expect(t, n.String("app"), "martini")
+		expect(t, n.String("user_id"), "42")
+		expect(t, n.String("request_id"), "abc")
+		expect(t, n.Get("missing"), nil)
+	})
+
+	m.ServeHTTP(recorder, (*http.Request)(nil))
+
+	// request values are not mapped on the instance
+	m.Invoke(func(n Named) {
+		expect(t, len(n), 1)
+		expect(t, n.String("user_id"), "")
+	})
+}
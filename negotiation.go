@@ -0,0 +1,79 @@
+package martini
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptSpec is a media range of an Accept header, with its quality.
+type acceptSpec struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses the media ranges of an Accept header, skipping malformed ones.
+func parseAccept(header string) []acceptSpec {
+	var specs []acceptSpec
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+		slash := strings.Index(mediaRange, "/")
+		if slash <= 0 || slash == len(mediaRange)-1 {
+			continue
+		}
+		spec := acceptSpec{mediaRange[:slash], mediaRange[slash+1:], 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					spec.q = q
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// negotiate returns the offer the Accept header prefers, "" if it accepts none of them.
+// Each offer gets the quality of the most specific media range matching it; on a tie the earlier offer wins.
+// With no Accept header, any offer is acceptable and the first one is returned.
+func negotiate(header string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+	specs := parseAccept(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		lower := strings.ToLower(offer)
+		slash := strings.Index(lower, "/")
+		if slash < 0 {
+			continue
+		}
+		typ, subtype := lower[:slash], lower[slash+1:]
+
+		q, specificity := 0.0, -1
+		for _, spec := range specs {
+			s := -1
+			switch {
+			case spec.typ == typ && spec.subtype == subtype:
+				s = 2
+			case spec.typ == typ && spec.subtype == "*":
+				s = 1
+			case spec.typ == "*" && spec.subtype == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = spec.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,57 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Negotiate(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/html"}
+	tests := []struct {
+		accept string
+		out    string
+	}{
+		{"", "application/json"},
+		{"text/html", "text/html"},
+		{"application/xml, text/html", "application/xml"},
+		{"application/json;q=0.5, application/xml", "application/xml"},
+		{"text/*", "text/html"},
+		{"*/*", "application/json"},
+		{"*/*;q=0.1, text/html;q=0.8", "text/html"},
+		{"application/*;q=0.9, application/json;q=0", "application/xml"},
+		{"image/png", ""},
+		{"TEXT/HTML", "text/html"},
+		{"garbage", ""},
+	}
+
+	for _, test := range tests {
+		expect(t, negotiate(test.accept, offers), test.out)
+	}
+	expect(t, negotiate("*/*", nil), "")
+}
+
+func Test_Context_Accepts(t *testing.T) {
+	m := Classic()
+	m.Get("/", func(c Context) string {
+		switch c.Accepts("application/json", "text/html") {
+		case "application/json":
+			return `{"hello":"world"}`
+		case "text/html":
+			return "<h1>hello world</h1>"
+		}
+		return "hello world"
+	})
+
+	for accept, body := range map[string]string{
+		"text/html,application/xhtml+xml,*/*;q=0.8": "<h1>hello world</h1>",
+		"application/json":                          `{"hello":"world"}`,
+		"text/plain":                                "hello world",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+		req.Header.Set("Accept", accept)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Body.String(), body)
+	}
+}
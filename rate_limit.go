@@ -0,0 +1,95 @@
+package martini
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit returns a middleware handler that allows each client rate requests per second on average, with
+// bursts of up to burst requests. Clients are told apart by keyFunc, by their ClientIP if it is nil.
+// Requests over the limit get a 429 with a Retry-After header and the rest of the chain is skipped.
+//
+// The limits are kept in memory, clients that have been idle long enough to be back at a full burst are
+// forgotten as other requests come in.
+func RateLimit(rate, burst int, keyFunc func(*http.Request) string) Handler {
+	if rate <= 0 || burst <= 0 {
+		panic("martini: RateLimit requires a positive rate and burst")
+	}
+	if keyFunc == nil {
+		keyFunc = ClientIP
+	}
+	limiter := newRateLimiter(float64(rate), float64(burst), time.Now)
+
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		if wait, ok := limiter.allow(keyFunc(req)); !ok {
+			res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(res, "429 too many requests", http.StatusTooManyRequests)
+			c.Abort()
+		}
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens added per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter(rate, burst float64, now func() time.Time) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket), lastSweep: now(), now: now}
+}
+
+// fullAfter is how long an empty bucket takes to fill up again.
+func (l *rateLimiter) fullAfter() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// allow takes a token from the key's bucket, or returns how long to wait for the next one if it is empty.
+func (l *rateLimiter) allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep forgets the buckets that are full again, at most once per fill up time.
+func (l *rateLimiter) sweep(now time.Time) {
+	idle := l.fullAfter()
+	if idle < time.Second {
+		idle = time.Second
+	}
+	if now.Sub(l.lastSweep) < idle {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
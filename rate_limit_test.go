@@ -0,0 +1,62 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_RateLimit(t *testing.T) {
+	m := Classic()
+	m.Use(RateLimit(1, 2, nil))
+	m.Get("/", func() string {
+		return "hello"
+	})
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+		req.RemoteAddr = addr
+		m.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	expect(t, serve("10.0.0.1:1234").Code, http.StatusOK)
+	expect(t, serve("10.0.0.1:1235").Code, http.StatusOK)
+
+	recorder := serve("10.0.0.1:1236")
+	expect(t, recorder.Code, http.StatusTooManyRequests)
+	expect(t, recorder.HeaderMap.Get("Retry-After"), "1")
+	expect(t, recorder.Body.String(), "429 too many requests\n")
+
+	// other clients have their own limit
+	expect(t, serve("10.0.0.2:1234").Code, http.StatusOK)
+}
+
+func Test_RateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2, 2, func() time.Time { return now })
+
+	_, ok := l.allow("a")
+	expect(t, ok, true)
+	_, ok = l.allow("a")
+	expect(t, ok, true)
+	wait, ok := l.allow("a")
+	expect(t, ok, false)
+	expect(t, wait, 500*time.Millisecond)
+
+	// refills over time
+	now = now.Add(500 * time.Millisecond)
+	_, ok = l.allow("a")
+	expect(t, ok, true)
+	_, ok = l.allow("b")
+	expect(t, ok, true)
+	expect(t, len(l.buckets), 2)
+
+	// idle buckets are forgotten
+	now = now.Add(time.Hour)
+	_, ok = l.allow("c")
+	expect(t, ok, true)
+	expect(t, len(l.buckets), 1)
+}
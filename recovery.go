@@ -110,22 +110,64 @@ func function(pc uintptr) []byte {
 	return name
 }
 
+// RecoveryOptions is a struct for specifying configuration options for the martini.Recovery middleware.
+type RecoveryOptions struct {
+	// Logger is the logger the panic and its stack trace are written to. Defaults to the *log.Logger mapped on the context.
+	Logger *log.Logger
+	// HideStack leaves the stack trace out of the panic page shown in development mode.
+	HideStack bool
+	// Formatter, when set, writes the response for the recovered value in place of the default 500 page.
+	// It is called with the current context, so services such as the ResponseWriter can be looked up from it.
+	Formatter func(c Context, err interface{})
+	// Reporter, when set, is called with the recovered value and the stack trace of the panicking goroutine
+	// before the response is written, e.g. to forward the panic to an error tracking service.
+	Reporter func(err interface{}, stack []byte)
+}
+
 // Recovery returns a middleware that recovers from any panics and writes a 500 if there was one.
-// While Martini is in development mode, Recovery will also output the panic as HTML.
+// While Martini is in development mode, Recovery will also output the panic as HTML, unless SetErrorRenderer was called.
 func Recovery() Handler {
+	return RecoveryWithOptions(RecoveryOptions{})
+}
+
+// RecoveryWithOptions returns a middleware that recovers from any panics like Recovery does, configured by the given options.
+func RecoveryWithOptions(opt RecoveryOptions) Handler {
 	return func(c Context, log *log.Logger) {
 		defer func() {
 			if err := recover(); err != nil {
 				stack := stack(3)
-				log.Printf("PANIC: %s\n%s", err, stack)
+				logger := log
+				if opt.Logger != nil {
+					logger = opt.Logger
+				}
+				if IsInvokeError(err) {
+					// not a crash, a handler asked for something that isn't there
+					logger.Printf("INVOKE ERROR: %s\n%s", err, stack)
+				} else {
+					logger.Printf("PANIC: %s\n%s", err, stack)
+				}
+				if opt.Reporter != nil {
+					opt.Reporter(err, stack)
+				}
+
+				if opt.Formatter != nil {
+					opt.Formatter(c, err)
+					return
+				}
 
 				// Lookup the current responsewriter
 				val := c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
 				res := val.Interface().(http.ResponseWriter)
+				if renderError(http.StatusInternalServerError, res) {
+					return
+				}
 
 				// respond with panic message while in development mode
 				var body []byte
-				if Env == Dev {
+				if IsDev() {
+					if opt.HideStack {
+						stack = nil
+					}
 					res.Header().Set("Content-Type", "text/html")
 					body = []byte(fmt.Sprintf(panicHtml, err, err, stack))
 				} else {
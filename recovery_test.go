@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -47,3 +48,131 @@ func Test_Recovery_ResponseWriter(t *testing.T) {
 	expect(t, recorder2.HeaderMap.Get("Content-Type"), "text/html")
 	refute(t, recorder2.Body.Len(), 0)
 }
+
+func Test_RecoveryWithOptions(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+
+	setENV(Dev)
+	m := New()
+	m.Use(RecoveryWithOptions(RecoveryOptions{
+		Logger: log.New(buff, "[api] ", 0),
+		Formatter: func(c Context, err interface{}) {
+			res := c.ResponseWriter()
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusInternalServerError)
+			res.Write([]byte(`{"error":"` + err.(string) + `"}`))
+		},
+	}))
+	m.Use(func() {
+		panic("here is a panic!")
+	})
+	m.ServeHTTP(recorder, (*http.Request)(nil))
+
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "application/json")
+	expect(t, recorder.Body.String(), `{"error":"here is a panic!"}`)
+	expect(t, strings.HasPrefix(buff.String(), "[api] PANIC: here is a panic!"), true)
+}
+
+func Test_RecoveryWithOptions_HideStack(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	setENV(Dev)
+	m := New()
+	m.Map(log.New(bytes.NewBufferString(""), "[martini] ", 0))
+	m.Use(RecoveryWithOptions(RecoveryOptions{HideStack: true}))
+	m.Use(func() {
+		panic("here is a panic!")
+	})
+	m.ServeHTTP(recorder, (*http.Request)(nil))
+
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, strings.Contains(recorder.Body.String(), "recovery_test.go"), false)
+}
+
+func Test_RecoveryWithOptions_Reporter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	var reported interface{}
+	var reportedStack []byte
+	m := New()
+	m.Map(log.New(bytes.NewBufferString(""), "[martini] ", 0))
+	m.Use(RecoveryWithOptions(RecoveryOptions{
+		Reporter: func(err interface{}, stack []byte) {
+			reported = err
+			reportedStack = stack
+		},
+	}))
+	m.Use(func() {
+		panic("here is a panic!")
+	})
+	m.ServeHTTP(recorder, (*http.Request)(nil))
+
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, reported, "here is a panic!")
+	expect(t, strings.Contains(string(reportedStack), "recovery_test.go"), true)
+}
+
+func Test_Recovery_InvokeError(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+
+	type missingService struct{}
+	var reported interface{}
+	m := New()
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(RecoveryWithOptions(RecoveryOptions{
+		Reporter: func(err interface{}, stack []byte) {
+			reported = err
+		},
+	}))
+	m.Use(func(s *missingService) {})
+	m.ServeHTTP(recorder, (*http.Request)(nil))
+
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, IsInvokeError(reported), true)
+	expect(t, strings.HasPrefix(buff.String(), "[martini] INVOKE ERROR: martini: Value not found for type *martini.missingService"), true)
+	expect(t, IsInvokeError("here is a panic!"), false)
+}
+
+func Test_Recovery_Group(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	globalReports := 0
+
+	setENV(Prod)
+	defer setENV(Dev)
+	m := Classic()
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(RecoveryWithOptions(RecoveryOptions{Reporter: func(err interface{}, stack []byte) {
+		globalReports++
+	}}))
+	m.Group("/api", func(r Router) {
+		r.Get("/users", func() {
+			panic("api down")
+		})
+	}, RecoveryWithOptions(RecoveryOptions{Formatter: func(c Context, err interface{}) {
+		res := c.ResponseWriter()
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte(`{"error":"` + err.(string) + `"}`))
+	}}))
+	m.Get("/page", func() {
+		panic("page down")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/api/users", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "application/json")
+	expect(t, recorder.Body.String(), `{"error":"api down"}`)
+	expect(t, globalReports, 0)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/page", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Body.String(), "500 Internal Server Error")
+	expect(t, globalReports, 1)
+}
@@ -0,0 +1,230 @@
+package martini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codegangsta/inject"
+)
+
+// Render is a service that renders responses. It is mapped by the Renderer middleware, so handlers can ask for it:
+//
+//	m.Get("/users/:id", func(r martini.Render, params martini.Params) {
+//		r.HTML(http.StatusOK, "users/show", params["id"])
+//	})
+type Render interface {
+	// HTML renders the named template with the given data, inside the layout of the RenderOptions if any.
+	// An optional layout name replaces that layout for this response, "" renders without a layout.
+	HTML(status int, name string, data interface{}, layout ...string)
+	// JSON writes the value encoded as JSON.
+	JSON(status int, v interface{})
+	// Template returns the templates the Render was set up with.
+	Template() *template.Template
+}
+
+// RenderOptions is a struct for specifying configuration options for the martini.Renderer middleware.
+type RenderOptions struct {
+	// Directory to load templates from, relative to martini.Root unless absolute. Defaults to "templates".
+	Directory string
+	// FileSystem to load templates from, in place of Directory. Takes an embedded file system wrapped with http.FS, for instance.
+	FileSystem http.FileSystem
+	// Extensions of the files loaded as templates. Defaults to [".tmpl", ".html"].
+	Extensions []string
+	// Layout is the name of the template HTML renders the others in, where it calls {{ yield }}. No layout by default.
+	Layout string
+	// Funcs are added to the templates' functions.
+	Funcs []template.FuncMap
+	// Charset sent in the Content-Type header. Defaults to "UTF-8".
+	Charset string
+}
+
+// Renderer returns a middleware handler that maps a Render service for the handlers that follow. Templates are
+// named after their path relative to the template directory, without the extension, such as "users/show" for
+// templates/users/show.tmpl. They are loaded once, when Renderer is called, which panics if one doesn't parse.
+func Renderer(options ...RenderOptions) Handler {
+	opt := prepareRenderOptions(options)
+	layouts := loadTemplates(opt)
+	// html/template won't clone a set that has executed, so the set the layouts are cloned from never is
+	t, err := layouts.Clone()
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c Context) {
+		c.MapTo(&renderer{c, t, layouts, opt}, (*Render)(nil))
+	}
+}
+
+func prepareRenderOptions(options []RenderOptions) RenderOptions {
+	var opt RenderOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	// Defaults
+	if opt.FileSystem == nil {
+		dir := opt.Directory
+		if dir == "" {
+			dir = "templates"
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(Root, dir)
+		}
+		opt.FileSystem = http.Dir(dir)
+	}
+	if len(opt.Extensions) == 0 {
+		opt.Extensions = []string{".tmpl", ".html"}
+	}
+	if opt.Charset == "" {
+		opt.Charset = "UTF-8"
+	}
+	return opt
+}
+
+func loadTemplates(opt RenderOptions) *template.Template {
+	t := template.New("")
+	t.Funcs(template.FuncMap{
+		// replaced when rendering inside a layout
+		"yield": func() (template.HTML, error) {
+			return "", fmt.Errorf("yield called outside of a layout")
+		},
+	})
+	for _, funcs := range opt.Funcs {
+		t.Funcs(funcs)
+	}
+
+	err := walkFileSystem(opt.FileSystem, "/", func(name string) error {
+		ext := path.Ext(name)
+		if !hasExtension(opt.Extensions, ext) {
+			return nil
+		}
+		f, err := opt.FileSystem.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		_, err = t.New(strings.TrimSuffix(strings.TrimPrefix(name, "/"), ext)).Parse(string(b))
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// walkFileSystem calls fn with the name of each file below dir.
+func walkFileSystem(fs http.FileSystem, dir string, fn func(name string) error) error {
+	f, err := fs.Open(dir)
+	if err != nil {
+		// no templates
+		return nil
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := path.Join(dir, info.Name())
+		if info.IsDir() {
+			err = walkFileSystem(fs, name, fn)
+		} else {
+			err = fn(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+type renderer struct {
+	c       Context
+	t       *template.Template // executed directly, when rendering without a layout
+	layouts *template.Template // never executed, cloned for each render inside a layout
+	opt     RenderOptions
+}
+
+func (r *renderer) HTML(status int, name string, data interface{}, layout ...string) {
+	l := r.opt.Layout
+	if len(layout) > 0 {
+		l = layout[0]
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if l == "" {
+		err = r.t.ExecuteTemplate(&buf, name, data)
+	} else {
+		err = r.executeInLayout(&buf, l, name, data)
+	}
+	if err != nil {
+		http.Error(r.response(), err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.write(status, "text/html", buf.Bytes())
+}
+
+// executeInLayout renders the layout, in which yield renders the named template.
+func (r *renderer) executeInLayout(buf *bytes.Buffer, layout, name string, data interface{}) error {
+	// clone the templates, so concurrent requests don't share the yield func
+	t, err := r.layouts.Clone()
+	if err != nil {
+		return err
+	}
+	t.Funcs(template.FuncMap{
+		"yield": func() (template.HTML, error) {
+			var content bytes.Buffer
+			err := t.ExecuteTemplate(&content, name, data)
+			return template.HTML(content.String()), err
+		},
+	})
+	return t.ExecuteTemplate(buf, layout, data)
+}
+
+func (r *renderer) JSON(status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(r.response(), err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.write(status, "application/json", b)
+}
+
+func (r *renderer) Template() *template.Template {
+	return r.t
+}
+
+func (r *renderer) write(status int, contentType string, body []byte) {
+	res := r.response()
+	res.Header().Set("Content-Type", contentType+"; charset="+r.opt.Charset)
+	res.WriteHeader(status)
+	res.Write(body)
+}
+
+// response returns the http.ResponseWriter mapped when rendering, rather than when Renderer ran, so the
+// writers of middleware added after it, such as Gzip or Timeout, see the rendered response.
+func (r *renderer) response() http.ResponseWriter {
+	rv := r.c.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+	return rv.Interface().(http.ResponseWriter)
+}
@@ -0,0 +1,160 @@
+package martini
+
+import (
+	"compress/gzip"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates creates a template directory with the given files, removed by the returned func.
+func writeTemplates(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "martini_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func Test_Render_HTML(t *testing.T) {
+	dir, cleanup := writeTemplates(t, map[string]string{
+		"hello.tmpl":      "<h1>Hello {{ . }}</h1>",
+		"users/show.tmpl": "<p>{{ upper . }}</p>",
+		"layout.tmpl":     "<html>{{ yield }}</html>",
+		"notes.txt":       "not a template {{",
+	})
+	defer cleanup()
+
+	m := Classic()
+	m.Use(Renderer(RenderOptions{
+		Directory: dir,
+		Layout:    "layout",
+		Funcs:     []template.FuncMap{{"upper": strings.ToUpper}},
+	}))
+	m.Get("/hello", func(r Render) {
+		r.HTML(http.StatusOK, "hello", "<jeremy>")
+	})
+	m.Get("/users", func(r Render) {
+		r.HTML(http.StatusCreated, "users/show", "jeremy", "")
+	})
+	m.Get("/missing", func(r Render) {
+		r.HTML(http.StatusOK, "missing", nil)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/hello", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "text/html; charset=UTF-8")
+	expect(t, recorder.Body.String(), "<html><h1>Hello &lt;jeremy&gt;</h1></html>")
+
+	// without the layout
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/users", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusCreated)
+	expect(t, recorder.Body.String(), "<p>JEREMY</p>")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/missing", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+}
+
+func Test_Render_JSON(t *testing.T) {
+	m := Classic()
+	m.Use(Renderer(RenderOptions{Directory: "does-not-exist", Charset: "ISO-8859-1"}))
+	m.Get("/", func(r Render) {
+		r.JSON(http.StatusAccepted, map[string]string{"hello": "world"})
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusAccepted)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "application/json; charset=ISO-8859-1")
+	expect(t, recorder.Body.String(), `{"hello":"world"}`)
+}
+
+func Test_Render_FileSystem(t *testing.T) {
+	dir, cleanup := writeTemplates(t, map[string]string{
+		"views/index.html": "index",
+	})
+	defer cleanup()
+
+	m := Classic()
+	m.Use(Renderer(RenderOptions{FileSystem: http.Dir(filepath.Join(dir, "views"))}))
+	m.Get("/", func(r Render) {
+		expect(t, r.Template().Lookup("index") != nil, true)
+		r.HTML(http.StatusOK, "index", nil)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "index")
+}
+
+func Test_Render_LayoutAfterPlain(t *testing.T) {
+	dir, cleanup := writeTemplates(t, map[string]string{
+		"hello.tmpl":  "hello",
+		"layout.tmpl": "<html>{{ yield }}</html>",
+	})
+	defer cleanup()
+
+	m := Classic()
+	m.Use(Renderer(RenderOptions{Directory: dir, Layout: "layout"}))
+	m.Get("/laid", func(r Render) {
+		r.HTML(http.StatusOK, "hello", nil)
+	})
+	m.Get("/plain", func(r Render) {
+		r.HTML(http.StatusOK, "hello", nil, "")
+	})
+
+	for _, r := range []struct{ path, body string }{
+		{"/laid", "<html>hello</html>"},
+		{"/plain", "hello"},
+		{"/laid", "<html>hello</html>"},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+r.path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Code, http.StatusOK)
+		expect(t, recorder.Body.String(), r.body)
+	}
+}
+
+func Test_Render_BeforeGzip(t *testing.T) {
+	m := Classic()
+	m.Use(Renderer(RenderOptions{Directory: "does-not-exist"}))
+	m.Use(Gzip())
+	m.Get("/", func(r Render) {
+		r.JSON(http.StatusOK, map[string]string{"hello": "world"})
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.HeaderMap.Get("Content-Encoding"), "gzip")
+	gz, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(gz)
+	expect(t, string(body), `{"hello":"world"}`)
+}
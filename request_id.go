@@ -0,0 +1,74 @@
+package martini
+
+import (
+	gocontext "context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestIDHeader is the header the RequestID middleware reads an inbound request ID from and sets on the response.
+const RequestIDHeader = "X-Request-ID"
+
+// contextKey is the type of the keys Martini stores values under in a context.Context, so they can't collide
+// with the keys of other packages.
+type contextKey struct {
+	name string
+}
+
+// RequestIDKey is the context.Context key the RequestID middleware stores the request ID under, for code that
+// only gets the request's context.Context, such as database or RPC clients.
+var RequestIDKey = &contextKey{"request-id"}
+
+// RequestIDFromContext returns the request ID stored in ctx by the RequestID middleware, or "" if there is none.
+func RequestIDFromContext(ctx gocontext.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// maxRequestIDLength bounds the length of an inbound request ID that will be trusted.
+const maxRequestIDLength = 128
+
+// RequestID returns a middleware handler that tags each request with an ID, reusing the one sent in the
+// X-Request-ID header if there is one and generating a new one otherwise. The ID is set on the response
+// header and stored under RequestIDKey in the request's context.Context, and a *log.Logger prefixed with it
+// is mapped into the request context so that any handler requesting a *log.Logger after this middleware gets
+// the per-request instance.
+func RequestID() Handler {
+	return func(res http.ResponseWriter, req *http.Request, c Context, logger *log.Logger) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		res.Header().Set(RequestIDHeader, id)
+		c.WithValue(RequestIDKey, id)
+		c.Map(log.New(logger.Writer(), logger.Prefix()+"["+id+"] ", logger.Flags()))
+	}
+}
+
+// newRequestID generates a random 128 bit request ID, hex encoded.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether an inbound request ID is safe to reuse, keeping clients from
+// injecting arbitrary content into the logs.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package martini
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_RequestID(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	// replace log for testing
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(RequestID())
+	var fromContext string
+	m.Use(func(res http.ResponseWriter, req *http.Request, log *log.Logger) {
+		log.Println("handled")
+		fromContext = RequestIDFromContext(req.Context())
+		res.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foobar", nil)
+	m.ServeHTTP(recorder, req)
+
+	id := recorder.Header().Get(RequestIDHeader)
+	expect(t, len(id), 32)
+	expect(t, fromContext, id)
+	expect(t, RequestIDFromContext(req.Context()), "")
+	expect(t, buff.String(), "[martini] ["+id+"] handled\n")
+}
+
+func Test_RequestID_Inbound(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	// replace log for testing
+	m.Map(log.New(buff, "[martini] ", 0))
+	m.Use(RequestID())
+	m.Use(func(log *log.Logger) {
+		log.Println("handled")
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foobar", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Header().Get(RequestIDHeader), "abc-123")
+	expect(t, strings.HasPrefix(buff.String(), "[martini] [abc-123] "), true)
+
+	// ids that could forge log lines are replaced
+	recorder = httptest.NewRecorder()
+	req.Header.Set(RequestIDHeader, "abc\nPANIC: forged")
+	m.ServeHTTP(recorder, req)
+
+	expect(t, len(recorder.Header().Get(RequestIDHeader)), 32)
+}
@@ -5,30 +5,50 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 )
 
 // ResponseWriter is a wrapper around http.ResponseWriter that provides extra information about
-// the response. 
+// the response. Martini wraps every response in one, so handlers and middleware can rely on the
+// http.ResponseWriter they are given implementing it.
 // It is recommended that middleware handlers use this construct to wrap a responsewriter
-// if the functionality calls for it.
+// if the functionality calls for it: embedding the ResponseWriter they were given, and overriding
+// the methods they change, keeps the other methods working.
 type ResponseWriter interface {
 
 	http.ResponseWriter
+	// Flush sends the buffered response to the client, writing a 200 first if nothing was written yet.
+	// It does nothing if the underlying http.ResponseWriter can't flush.
 	http.Flusher
+	// Hijack takes over the connection, such as for a WebSocket, and fails if the underlying
+	// http.ResponseWriter can't be hijacked, as with HTTP/2.
 	http.Hijacker
 
 	// Status returns the status code of the response or 0 if the response has not been written.
+	// Only the first WriteHeader call, or the implicit 200 of the first Write, sets the status; later calls are ignored.
 	Status() int
-	// Written returns whether or not the ResponseWriter has been written.
+	// Written returns whether or not the ResponseWriter has been written, or its connection hijacked.
 	Written() bool
 	// Size returns the size of the response body.
 	Size() int
 
 	// Before allows for a function to be called before the ResponseWriter has been written to. This is
 	// useful for setting headers or any other operations that must happen before a response has been written.
+	// The functions are called once, in the order they were registered, right before the header is written.
 	Before(BeforeFunc)
 }
 
+// The ResponseWriter created by Martini also implements http.Pusher, returning http.ErrNotSupported if the
+// connection doesn't support HTTP/2 server push, and reports whether the connection has been hijacked with a
+// Hijacked() bool method, in which case Status stays 0. They are left out of the interface, so other
+// implementations keep satisfying it; check for them with a type assertion. It implements http.CloseNotifier
+// when the http.ResponseWriter it wraps does.
+var (
+	_ ResponseWriter     = (*responseWriter)(nil)
+	_ http.Pusher        = (*responseWriter)(nil)
+	_ http.CloseNotifier = (*closeNotifyResponseWriter)(nil)
+)
+
 // BeforeFunc is a function that is called before the ResponseWriter has been written to.
 type BeforeFunc func(ResponseWriter)
 
@@ -36,7 +56,7 @@ type BeforeFunc func(ResponseWriter)
 
 // NewResponseWriter creates a ResponseWriter that wraps an http.ResponseWriter
 func NewResponseWriter(rw http.ResponseWriter) ResponseWriter {
-	newRw := responseWriter{rw, 0, 0, nil}
+	newRw := responseWriter{rw, 0, 0, nil, false}
 	if cn, ok := rw.(http.CloseNotifier); ok {
 		return &closeNotifyResponseWriter{newRw, cn}
 	}
@@ -45,14 +65,42 @@ func NewResponseWriter(rw http.ResponseWriter) ResponseWriter {
 
 
 
+var responseWriterPool = sync.Pool{
+	New: func() interface{} {
+		return new(closeNotifyResponseWriter)
+	},
+}
+
+// acquireResponseWriter is like NewResponseWriter, taking the wrapper from a pool. The second value must be
+// given back with releaseResponseWriter once the response is done.
+func acquireResponseWriter(rw http.ResponseWriter) (ResponseWriter, *closeNotifyResponseWriter) {
+	w := responseWriterPool.Get().(*closeNotifyResponseWriter)
+	w.responseWriter = responseWriter{ResponseWriter: rw}
+	if cn, ok := rw.(http.CloseNotifier); ok {
+		w.closeNotifier = cn
+		return w, w
+	}
+	return &w.responseWriter, w
+}
+
+func releaseResponseWriter(w *closeNotifyResponseWriter) {
+	*w = closeNotifyResponseWriter{}
+	responseWriterPool.Put(w)
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	status      int
 	size        int
 	beforeFuncs []BeforeFunc
+	hijacked    bool
 }
 
 func (rw *responseWriter) WriteHeader(s int) {
+	if rw.Written() {
+		// the status has been sent already, keep the first one rather than having net/http complain
+		return
+	}
 	rw.callBefore()
 	rw.ResponseWriter.WriteHeader(s)
 	rw.status = s
@@ -77,7 +125,19 @@ func (rw *responseWriter) Size() int {
 }
 
 func (rw *responseWriter) Written() bool {
-	return rw.status != 0
+	return rw.status != 0 || rw.hijacked
+}
+
+func (rw *responseWriter) Hijacked() bool {
+	return rw.hijacked
+}
+
+// hijacked reports whether the connection of rw has been hijacked, if rw can tell.
+func hijacked(rw ResponseWriter) bool {
+	h, ok := rw.(interface {
+		Hijacked() bool
+	})
+	return ok && h.Hijacked()
 }
 
 func (rw *responseWriter) Before(before BeforeFunc) {
@@ -89,18 +149,38 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if !ok {
 		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
 	}
-	return hijacker.Hijack()
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		// the connection belongs to the caller now, nothing else may be written
+		rw.hijacked = true
+	}
+	return conn, buf, err
+}
+
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := rw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
 }
 
 func (rw *responseWriter) callBefore() {
-	for i := len(rw.beforeFuncs) - 1; i >= 0; i-- {
-		rw.beforeFuncs[i](rw)
+	// each function runs only once, even if WriteHeader is called again
+	beforeFuncs := rw.beforeFuncs
+	rw.beforeFuncs = nil
+	for _, before := range beforeFuncs {
+		before(rw)
 	}
 }
 
 func (rw *responseWriter) Flush() {
 	flusher, ok := rw.ResponseWriter.(http.Flusher)
 	if ok {
+		if !rw.Written() {
+			// The status will be StatusOK if WriteHeader has not been called yet
+			rw.WriteHeader(http.StatusOK)
+		}
 		flusher.Flush()
 	}
 }
@@ -85,6 +85,40 @@ func Test_ResponseWriter_WritingHeader(t *testing.T) {
 	expect(t, rw.Size(), 0)
 }
 
+type countingRecorder struct {
+	*httptest.ResponseRecorder
+	writeHeaders int
+}
+
+func (c *countingRecorder) WriteHeader(s int) {
+	c.writeHeaders++
+	c.ResponseRecorder.WriteHeader(s)
+}
+
+func Test_ResponseWriter_DuplicateWriteHeader(t *testing.T) {
+	rec := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rw := NewResponseWriter(rec)
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.WriteHeader(http.StatusInternalServerError)
+	rw.Write([]byte("Hello world"))
+
+	expect(t, rec.writeHeaders, 1)
+	expect(t, rec.Code, http.StatusCreated)
+	expect(t, rw.Status(), http.StatusCreated)
+
+	// a Write sends the 200 once
+	rec = &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rw = NewResponseWriter(rec)
+	rw.Write([]byte("Hello"))
+	rw.Write([]byte(" world"))
+	rw.WriteHeader(http.StatusNotFound)
+
+	expect(t, rec.writeHeaders, 1)
+	expect(t, rw.Status(), http.StatusOK)
+	expect(t, rec.Body.String(), "Hello world")
+}
+
 func Test_ResponseWriter_Before(t *testing.T) {
 	rec := httptest.NewRecorder()
 	rw := NewResponseWriter(rec)
@@ -103,7 +137,11 @@ func Test_ResponseWriter_Before(t *testing.T) {
 	expect(t, rec.Body.String(), "")
 	expect(t, rw.Status(), http.StatusNotFound)
 	expect(t, rw.Size(), 0)
-	expect(t, result, "barfoo")
+	expect(t, result, "foobar")
+
+	// before functions only run once
+	rw.Write([]byte("Hello world"))
+	expect(t, result, "foobar")
 }
 
 func Test_ResponseWriter_Hijack(t *testing.T) {
@@ -116,6 +154,9 @@ func Test_ResponseWriter_Hijack(t *testing.T) {
 		t.Error(err)
 	}
 	expect(t, hijackable.Hijacked, true)
+	expect(t, rw.Written(), true)
+	expect(t, hijacked(rw), true)
+	expect(t, rw.Status(), 0)
 }
 
 func Test_ResponseWrite_Hijack_NotOK(t *testing.T) {
@@ -126,6 +167,46 @@ func Test_ResponseWrite_Hijack_NotOK(t *testing.T) {
 	_, _, err := hijacker.Hijack()
 
 	refute(t, err, nil)
+	expect(t, rw.Written(), false)
+	expect(t, hijacked(rw), false)
+}
+
+type pushableResponse struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushableResponse) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func Test_ResponseWriter_Push(t *testing.T) {
+	pushable := &pushableResponse{ResponseRecorder: httptest.NewRecorder()}
+	rw := NewResponseWriter(pushable).(http.Pusher)
+	expect(t, rw.Push("/app.css", nil), nil)
+	expect(t, len(pushable.pushed), 1)
+	expect(t, pushable.pushed[0], "/app.css")
+
+	rw = NewResponseWriter(httptest.NewRecorder()).(http.Pusher)
+	expect(t, rw.Push("/app.css", nil), http.ErrNotSupported)
+}
+
+// minimalResponseWriter implements ResponseWriter without Push or Hijacked, as other packages do.
+type minimalResponseWriter struct {
+	http.ResponseWriter
+	http.Hijacker
+}
+
+func (minimalResponseWriter) Flush()            {}
+func (minimalResponseWriter) Status() int       { return 0 }
+func (minimalResponseWriter) Written() bool     { return false }
+func (minimalResponseWriter) Size() int         { return 0 }
+func (minimalResponseWriter) Before(BeforeFunc) {}
+
+func Test_ResponseWriter_Minimal(t *testing.T) {
+	var rw ResponseWriter = minimalResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	expect(t, hijacked(rw), false)
 }
 
 func Test_ResponseWriter_CloseNotify(t *testing.T) {
@@ -151,6 +232,18 @@ func Test_ResponseWriter_Flusher(t *testing.T) {
 	expect(t, ok, true)
 }
 
+func Test_ResponseWriter_FlushWritesStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+
+	rw.Flush()
+
+	expect(t, rec.Flushed, true)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, rw.Status(), http.StatusOK)
+	expect(t, rw.Written(), true)
+}
+
 func Test_ResponseWriter_FlusherHandler(t *testing.T) {
 
 	// New martini instance
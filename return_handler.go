@@ -1,7 +1,10 @@
 package martini
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/codegangsta/inject"
+	"io"
 	"net/http"
 	"reflect"
 )
@@ -10,33 +13,251 @@ import (
 // when a route handler returns something. The ReturnHandler is
 // responsible for writing to the ResponseWriter based on the values
 // that are passed into this function.
+//
+// The default ReturnHandler accepts these return signatures, and nothing else:
+//
+//	body                             // the body is written with a 200
+//	status                           // only the status is written
+//	(status, body)
+//	(status, headers, body)          // headers is an http.Header or a map[string]string
+//	error, (body, error), (status, error), (status, body, error), (status, headers, body, error)
+//
+// The status is any integer type. A body is a string or a []byte, written as it is, an http.Handler that
+// serves the request itself, an io.Reader, which is copied to the response as it is read and closed
+// afterwards if it is an io.Closer, or any other value, written as formatted by fmt.Sprint. A non-nil error
+// replaces the response with its message and the returned status, 500 if none was returned.
+//
+// A nil body, such as a nil interface{} or pointer, writes nothing but the status, and nothing at all
+// is written once the handler has written the response itself.
+//
+// Like any service, a ReturnHandler mapped on the request overrides the one mapped on the Martini
+// instance, so a group or route can use its own return semantics:
+//
+//	r.Group("/api", func(r martini.Router) {
+//		// ...
+//	}, func(c martini.Context) {
+//		c.Map(martini.JSONReturnHandler())
+//	})
+//
+// Map a nil ReturnHandler to ignore return values altogether, for handlers that always write the
+// response themselves:
+//
+//	m.Map(martini.ReturnHandler(nil))
 type ReturnHandler func(Context, []reflect.Value)
 
 func defaultReturnHandler() ReturnHandler {
+	return returnHandler(false)
+}
+
+// JSONReturnHandler returns a ReturnHandler that behaves like the default one, except that returned
+// structs, maps, slices and arrays are encoded as JSON, with a Content-Type of application/json unless
+// one was already set. Strings and byte slices are written as they are. Map it to use it in place of
+// the default:
+//
+//	m.Map(martini.JSONReturnHandler())
+func JSONReturnHandler() ReturnHandler {
+	return returnHandler(true)
+}
+
+func returnHandler(encodeJSON bool) ReturnHandler {
 	return func(ctx Context, vals []reflect.Value) {                        // vals是返回值
 		rv := ctx.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))      // 从 ctx 中取出 http.ResponseWriter 类型的对象
 		res := rv.Interface().(http.ResponseWriter)                         // 从reflect.Value转化为http.ResponseWriter
-		var responseVal reflect.Value
-		if len(vals) > 1 && vals[0].Kind() == reflect.Int {                 // 第一个返回值 vals[0] 如果是int类型就将其写到返回的http头当中
-			res.WriteHeader(int(vals[0].Int()))
-			responseVal = vals[1] 											// 接下来的 vals[1] 存到 responseVal
-		} else if len(vals) > 0 {                                           // 如果只有一个返回值，则直接存到 responseVal
-			responseVal = vals[0]
+
+		// the handler wrote the response itself
+		if ctx.Written() {
+			return
+		}
+
+		ret := splitReturnValues(vals)
+		if ret.err != nil {
+			status := ret.status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			http.Error(res, ret.err.Error(), status)
+			return
+		}
+		if ret.headers.IsValid() {
+			setHeaders(res.Header(), ret.headers)
+		}
+
+		// a nil body means the handler has nothing more to write than the status, if any
+		if isNil(ret.body) {
+			if ret.status != 0 {
+				res.WriteHeader(ret.status)
+			}
+			return
+		}
+		writeReturnedBody(ctx, res, ret.status, ret.body, encodeJSON)
+	}
+}
+
+// returnValues are the values a handler returned, sorted out by their place in the signature.
+type returnValues struct {
+	status  int
+	headers reflect.Value
+	body    reflect.Value
+	err     error
+}
+
+// splitReturnValues sorts out the returned values, along the signatures the default ReturnHandler accepts.
+// A body that is invalid means none was returned.
+func splitReturnValues(vals []reflect.Value) returnValues {
+	var ret returnValues
+	// a trailing error value replaces the response with the error message when it is not nil
+	if len(vals) > 0 && isError(vals[len(vals)-1]) {
+		if errVal := vals[len(vals)-1]; !errVal.IsNil() {
+			ret.err = errVal.Interface().(error)
 		}
+		vals = vals[:len(vals)-1]
+	}
 
-	
-		// 如果返回值 responseVal 是接口指针类型则解引用到其包含或者指向对象
-		if canDeref(responseVal) {
-			responseVal = responseVal.Elem()
+	// 第一个返回值 vals[0] 如果是整数类型就将其作为 http 状态码
+	if len(vals) > 0 {
+		if status, ok := statusValue(vals[0]); ok {
+			ret.status = status
+			vals = vals[1:]
 		}
+	}
+	if ret.status != 0 && len(vals) > 1 && isHeaderValue(vals[0]) {
+		// (status, headers, body): the headers are set before the body is written
+		ret.headers = vals[0]
+		vals = vals[1:]
+	}
+	if len(vals) > 0 {
+		ret.body = vals[0]
+	}
+	return ret
+}
+
+// writeReturnedBody writes a body that is not nil, with the status unless it is 0.
+func writeReturnedBody(ctx Context, res http.ResponseWriter, status int, responseVal reflect.Value, encodeJSON bool) {
+	// a returned http.Handler serves the request itself
+	if handler, ok := asHandler(responseVal); ok {
+		req := ctx.Get(reflect.TypeOf((*http.Request)(nil))).Interface().(*http.Request)
+		handler.ServeHTTP(res, req)
+		return
+	}
 
+	// a returned io.Reader is streamed, rather than read into memory first
+	if reader, ok := asReader(responseVal); ok {
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		if status != 0 {
+			res.WriteHeader(status)
+		}
+		io.Copy(res, reader)
+		return
+	}
+
+	// 如果返回值 responseVal 是接口指针类型则解引用到其包含或者指向对象
+	for canDeref(responseVal) && !responseVal.IsNil() {
+		responseVal = responseVal.Elem()
+	}
+
+	var body []byte
+	if isByteSlice(responseVal) {
 		// 如果返回值 responseVal 是 uint8 slice 类型，也即字节数组，即直接按字节写入到body中
-		if isByteSlice(responseVal) {
-			res.Write(responseVal.Bytes())
-		} else {
-			res.Write([]byte(responseVal.String()))
+		body = responseVal.Bytes()
+	} else if encodeJSON && isJSONValue(responseVal) {
+		b, err := json.Marshal(responseVal.Interface())
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if res.Header().Get("Content-Type") == "" {
+			res.Header().Set("Content-Type", "application/json; charset=utf-8")
 		}
+		body = b
+	} else if responseVal.Kind() == reflect.String {
+		body = []byte(responseVal.String())
+	} else {
+		body = []byte(fmt.Sprint(responseVal.Interface()))
+	}
+
+	// the status is written last so that the headers above still make it into the response
+	if status != 0 {
+		res.WriteHeader(status)
+	}
+	res.Write(body)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func isError(val reflect.Value) bool {
+	return val.IsValid() && val.Type().Implements(errorType) && canDeref(val)
+}
+
+// statusValue returns the value as a status code, if it is an integer.
+func statusValue(val reflect.Value) (int, bool) {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(val.Uint()), true
+	}
+	return 0, false
+}
+
+// isNil reports whether val is nil, or an interface or pointer leading to nil.
+func isNil(val reflect.Value) bool {
+	for val.IsValid() && canDeref(val) {
+		if val.IsNil() {
+			return true
+		}
+		val = val.Elem()
+	}
+	return !val.IsValid()
+}
+
+func asHandler(val reflect.Value) (http.Handler, bool) {
+	if isNil(val) {
+		return nil, false
+	}
+	handler, ok := val.Interface().(http.Handler)
+	return handler, ok
+}
+
+func asReader(val reflect.Value) (io.Reader, bool) {
+	if isNil(val) {
+		return nil, false
+	}
+	reader, ok := val.Interface().(io.Reader)
+	return reader, ok
+}
+
+var headerType = reflect.TypeOf(http.Header(nil))
+var headerMapType = reflect.TypeOf(map[string]string(nil))
+
+func isHeaderValue(val reflect.Value) bool {
+	return val.Type() == headerType || val.Type() == headerMapType
+}
+
+// setHeaders sets the returned headers on h, replacing any values set before.
+func setHeaders(h http.Header, val reflect.Value) {
+	switch headers := val.Interface().(type) {
+	case http.Header:
+		for k, v := range headers {
+			h.Del(k)
+			for _, value := range v {
+				h.Add(k, value)
+			}
+		}
+	case map[string]string:
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+	}
+}
+
+func isJSONValue(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
 	}
+	return false
 }
 
 func isByteSlice(val reflect.Value) bool {
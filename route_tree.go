@@ -0,0 +1,114 @@
+package martini
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// routeNode is a node of the tree the router indexes its routes in, keyed by path segments, so that matching a
+// request only tries the few routes that can match its path rather than every route.
+//
+// Each route is stored under the leading segments of its pattern that are either plain text, or a param
+// without constraint such as :id, which any single segment goes through. Whatever follows, such as a
+// constraint, a glob or a regex, is left to the route's regex. The routes a path gets tried against are those
+// found on the way down the tree, in the order they were added, so that matching works as if every route was tried.
+type routeNode struct {
+	static map[string]*routeNode
+	param  *routeNode
+	routes []int // indexes in router.routes of the routes stored at this node
+}
+
+// paramSegment is the key of the param child in the segments returned by treeSegments.
+const paramSegment = ":"
+
+// staticSegmentReg matches the pattern segments that only match themselves: the ones without regex syntax.
+var staticSegmentReg = regexp.MustCompile(`^[A-Za-z0-9_\-~%@,;=!]+$`)
+var paramSegmentReg = regexp.MustCompile(`^:[A-Za-z0-9_]+$`)
+
+// treeSegments returns the leading segments of a route pattern that the tree can index the route by.
+func treeSegments(pattern string) []string {
+	if !strings.HasPrefix(pattern, "/") || strings.Contains(pattern, "|") {
+		// an alternation may match paths that don't start with the segments
+		return nil
+	}
+	var segments []string
+	parts := strings.Split(pattern[1:], "/")
+	for i, segment := range parts {
+		if i+1 < len(parts) && quantifiesSlash(parts[i+1]) {
+			// the slash before the next segment may be missing or repeated
+			break
+		}
+		if staticSegmentReg.MatchString(segment) {
+			segments = append(segments, segment)
+		} else if paramSegmentReg.MatchString(segment) {
+			segments = append(segments, paramSegment)
+		} else {
+			break
+		}
+	}
+	return segments
+}
+
+// quantifiesSlash reports whether a pattern segment starts with a regex quantifier, which applies to the slash
+// before it. Globs and catch-all params start with a * too, but they are replaced before the pattern becomes a regex.
+func quantifiesSlash(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	switch segment[0] {
+	case '?', '+', '{':
+		return true
+	case '*':
+		return !strings.HasPrefix(segment, "**") && !catchAllReg.MatchString("/"+segment)
+	}
+	return false
+}
+
+func (n *routeNode) insert(segments []string, index int) {
+	for _, segment := range segments {
+		var child *routeNode
+		if segment == paramSegment {
+			if n.param == nil {
+				n.param = &routeNode{}
+			}
+			child = n.param
+		} else {
+			if n.static == nil {
+				n.static = make(map[string]*routeNode)
+			}
+			if child = n.static[segment]; child == nil {
+				child = &routeNode{}
+				n.static[segment] = child
+			}
+		}
+		n = child
+	}
+	n.routes = append(n.routes, index)
+}
+
+// lookup returns the indexes of the routes that may match path, in ascending order.
+func (n *routeNode) lookup(path string) []int {
+	var indexes []int
+	if strings.HasPrefix(path, "/") {
+		indexes = n.collect(strings.Split(path[1:], "/"), nil)
+	} else {
+		indexes = append(indexes, n.routes...)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (n *routeNode) collect(segments []string, indexes []int) []int {
+	indexes = append(indexes, n.routes...)
+	if len(segments) == 0 {
+		return indexes
+	}
+	if child := n.static[segments[0]]; child != nil {
+		indexes = child.collect(segments[1:], indexes)
+	}
+	if n.param != nil && segments[0] != "" {
+		indexes = n.param.collect(segments[1:], indexes)
+	}
+	return indexes
+}
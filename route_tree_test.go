@@ -0,0 +1,100 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_TreeSegments(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"/":                   "",
+		"/users":              "users",
+		"/users/:id/posts":    "users,:,posts",
+		"/users/:id(\\d+)":    "users",
+		"/public/app.js":      "public",
+		"/files/*filepath":    "files",
+		"/glob/**/end":        "glob",
+		"/foo/?bar":           "",
+		"/foo/bar/+":          "foo",
+		"/foo|/bar":           "",
+		"(?i)/users":          "",
+		"/users/:id.json":     "users",
+		"/api/v1/:name/items": "api,v1,:,items",
+	} {
+		expect(t, strings.Join(treeSegments(pattern), ","), want)
+	}
+}
+
+// Test_RouteTree_MatchesLinear checks the tree finds the same routes as trying every route would.
+func Test_RouteTree_MatchesLinear(t *testing.T) {
+	patterns := []string{
+		"/", "/users", "/users/:id", "/users/:id(\\d+)/edit", "/users/new", "/files/*filepath", "/glob/**/end",
+		"/foo/?bar", "/public/app.js", "/a|/b", "/:name", "/:name/:sub", "(?i)/CASE", "/users/:id/posts/:post",
+	}
+	paths := []string{
+		"/", "/users", "/users/", "/users/1", "/users/new", "/users/1/edit", "/users/x/edit", "/files/a/b.txt",
+		"/glob/x/y/end", "/foobar", "/foo/bar", "/public/appxjs", "/b", "/anything", "/any/thing", "/case",
+		"/users/1/posts/2", "/users//posts/2", "",
+	}
+	r := NewRouter().(*router)
+	for i, pattern := range patterns {
+		r.Get(pattern, func() {}).Name(strconv.Itoa(i))
+	}
+	for _, path := range paths {
+		var linear *route
+		for _, route := range r.getRoutes() {
+			if match, _ := route.Match("GET", path); match == ExactMatch {
+				linear = route
+				break
+			}
+		}
+		_, _, found := r.matchRoute("GET", path, false)
+		if found != linear {
+			t.Errorf("%q matched %v rather than %v", path, found, linear)
+		}
+	}
+}
+
+func Test_RouteTree_Serve(t *testing.T) {
+	r, req := benchmarkRoutes(500)
+	m := New()
+	m.Action(r.Handle)
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+}
+
+func benchmarkRoutes(n int) (*router, *http.Request) {
+	r := NewRouter().(*router)
+	for i := 0; i < n; i++ {
+		r.Get("/resource"+strconv.Itoa(i)+"/:id", func() {})
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:3000/resource"+strconv.Itoa(n-1)+"/42", nil)
+	return r, req
+}
+
+func Benchmark_Router_500Routes(b *testing.B) {
+	r, req := benchmarkRoutes(500)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.matchRoute(req.Method, req.URL.Path, false)
+	}
+}
+
+// Benchmark_Router_500Routes_Linear tries every route in turn, as the router did before indexing them.
+func Benchmark_Router_500Routes_Linear(b *testing.B) {
+	r, req := benchmarkRoutes(500)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, route := range r.getRoutes() {
+			if match, _ := route.Match(req.Method, req.URL.Path); match == ExactMatch {
+				break
+			}
+		}
+	}
+}
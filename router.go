@@ -3,22 +3,46 @@ package martini
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+
+	"github.com/codegangsta/inject"
 )
 
 // Params is a map of name/value pairs for named routes. An instance of martini.Params is available to be injected into any route handler.
+// It is mapped once a route matches, before its handlers run, and is empty rather than nil for routes without parameters.
 type Params map[string]string
 
 // Router is Martini's de-facto routing interface. Supports HTTP verbs, stacked handlers, and dependency injection.
+//
+// Named params may be constrained with a regex, as in "/users/:id(\\d+)". A route whose captured segment does not
+// satisfy the constraint is skipped, so the request can be matched by a later route such as "/users/:name".
+//
+// A "*name" segment, which must be the last one, captures the rest of the path into the named param, slashes included:
+// "/files/*filepath" matches "/files/docs/readme.md" with filepath set to "docs/readme.md".
+//
+// A route may be given several handlers, which makes the leading ones per-route middleware:
+//
+//	r.Get("/admin", auth, func() string { return "admin" })
+//
+// Route handlers run after every handler added with Martini.Use, in the order given. Like global middleware they
+// may call Context.Next to wrap the rest of the route's chain, and the chain stops as soon as one of them writes
+// the response or calls Context.Abort. Services they map are only visible to the handlers that follow them.
 type Router interface {
 	Routes
 
-	// Group adds a group where related routes can be added.
+	// Group adds a group where related routes can be added. The handlers given run before those of each route
+	// of the group, so a Recovery among them catches the panics of the group's routes before a global Recovery
+	// does, and can format the response its own way:
+	//
+	//	m.Group("/api", func(r martini.Router) { ... }, martini.RecoveryWithOptions(martini.RecoveryOptions{Formatter: jsonError}))
 	Group(string, func(Router), ...Handler)
-	// Get adds a route for a HTTP GET request to the specified matching pattern.
+	// Get adds a route for a HTTP GET request to the specified matching pattern. The route also answers HEAD
+	// requests, with the body discarded, unless a HEAD route is registered for the same path.
 	Get(string, ...Handler) Route
 	// Patch adds a route for a HTTP PATCH request to the specified matching pattern.
 	Patch(string, ...Handler) Route
@@ -33,22 +57,51 @@ type Router interface {
 	// Head adds a route for a HTTP HEAD request to the specified matching pattern.
 	Head(string, ...Handler) Route
 	// Any adds a route for any HTTP method request to the specified matching pattern.
+	// Routes registered for a specific method on the same path take precedence over it.
 	Any(string, ...Handler) Route
+	// Match adds a route for each of the given HTTP methods to the specified matching pattern, sharing the handlers.
+	Match([]string, string, ...Handler) []Route
 	// AddRoute adds a route for a given HTTP method request to the specified matching pattern.
 	AddRoute(string, string, ...Handler) Route
-
-	// NotFound sets the handlers that are called when a no route matches a request. Throws a basic 404 by default.
+	// AddRoutes adds a route for a given HTTP method request to each of the specified matching patterns, sharing
+	// the handlers, such as to serve a page under an alias: r.AddRoutes("GET", []string{"/", "/home"}, home)
+	AddRoutes(string, []string, ...Handler) []Route
+	// Mount hands any request for the given path prefix, or a path below it, to the http.Handler, such as another
+	// *Martini. The handler sees the path relative to the prefix, so "/admin/users" mounted at "/admin" is served as "/users".
+	Mount(string, http.Handler)
+
+	// RedirectTrailingSlash sets whether a request for a path that is only routed with (or without) a trailing slash
+	// is redirected to the routed form, with a 301 for GET and HEAD requests and a 308 otherwise.
+	// While enabled, a trailing slash in the path is only matched by a trailing slash in the pattern. Disabled by default.
+	RedirectTrailingSlash(bool)
+
+	// NotFound sets the handlers that are called when a no route matches a request. Throws a basic 404 by default, see SetErrorRenderer.
+	// Requests for a path that is routed for other methods get a 405 with an Allow header instead, or a 200 for OPTIONS. The header lists HEAD along with GET, and OPTIONS.
+	// Handlers set with NotFound still answer those requests, with the Allow header set, until MethodNotAllowed is called.
 	NotFound(...Handler)
+	// MethodNotAllowed sets the handlers that are called when routes match the request path but not its method.
+	// The Allow header is set before they run. Throws a basic 405 by default, unless NotFound was called.
+	MethodNotAllowed(...Handler)
 
 	// Handle is the entry point for routing. This is used as a martini.Handler
 	Handle(http.ResponseWriter, *http.Request, Context)
 }
 
 type router struct {
-	routes     []*route
-	notFounds  []Handler
-	groups     []group
-	routesLock sync.RWMutex
+	routes      []*route
+	notFounds   []Handler
+	notAlloweds []Handler
+	// set once NotFound or MethodNotAllowed is called: a custom NotFound keeps answering the paths routed for
+	// other methods unless MethodNotAllowed is set too
+	customNotFound, customNotAllowed bool
+	groups      []group
+	routesLock  sync.RWMutex
+	tree        routeNode // indexes the routes by path, guarded by routesLock
+
+	redirectTrailingSlash bool
+	basePath              string // put in front of the URLs of URLFor, set by ClassicMartini.SetBasePath
+
+	validate func(Handler) // extra checks for route handlers, set by ClassicMartini.ValidateInjection
 }
 
 type group struct {
@@ -68,7 +121,22 @@ type group struct {
 //	r := martini.NewRouter()
 //	m.MapTo(r, (*martini.Routes)(nil))
 func NewRouter() Router {
-	return &router{notFounds: []Handler{http.NotFound}, groups: make([]group, 0)}
+	return &router{notFounds: []Handler{notFound}, notAlloweds: []Handler{methodNotAllowed}, groups: make([]group, 0)}
+}
+
+// notFound replies to the request with an HTTP 404 not found error.
+func notFound(res http.ResponseWriter, req *http.Request) {
+	if !renderError(http.StatusNotFound, res) {
+		http.NotFound(res, req)
+	}
+}
+
+// methodNotAllowed replies to the request with an HTTP 405 method not allowed error.
+func methodNotAllowed(res http.ResponseWriter) {
+	if renderError(http.StatusMethodNotAllowed, res) {
+		return
+	}
+	http.Error(res, "405 method not allowed", http.StatusMethodNotAllowed)
 }
 
 func (r *router) Group(pattern string, fn func(Router), h ...Handler) {
@@ -109,24 +177,67 @@ func (r *router) Any(pattern string, h ...Handler) Route {
 	return r.addRoute("*", pattern, h)
 }
 
+func (r *router) Match(methods []string, pattern string, h ...Handler) []Route {
+	declared := make([]string, len(methods))
+	for i, method := range methods {
+		declared[i] = strings.ToUpper(method)
+	}
+	routes := make([]Route, len(methods))
+	for i, method := range declared {
+		route := r.addRoute(method, pattern, h)
+		route.methods = declared
+		routes[i] = route
+	}
+	return routes
+}
+
 func (r *router) AddRoute(method, pattern string, h ...Handler) Route {
 	return r.addRoute(method, pattern, h)
 }
 
-func (r *router) Handle(res http.ResponseWriter, req *http.Request, context Context) {
-	bestMatch := NoMatch
-	var bestVals map[string]string
-	var bestRoute *route
+func (r *router) AddRoutes(method string, patterns []string, h ...Handler) []Route {
+	routes := make([]Route, len(patterns))
+	for i, pattern := range patterns {
+		routes[i] = r.addRoute(method, pattern, h)
+	}
+	return routes
+}
 
-	// 查找最match的路由规则
-	for _, route := range r.getRoutes() {
-		match, vals := route.Match(req.Method, req.URL.Path)
-		if match.BetterThan(bestMatch) {
-			bestMatch = match
-			bestVals = vals
-			bestRoute = route
-			if match == ExactMatch {
-				break
+// mountParam is the catch-all param holding the path below a mount point.
+const mountParam = "_mount"
+
+func (r *router) Mount(prefix string, handler http.Handler) {
+	prefix = strings.TrimRight(prefix, "/")
+	mount := func(res http.ResponseWriter, req *http.Request, params Params) {
+		u := *req.URL
+		u.Path = "/" + params[mountParam]
+		u.RawPath = ""
+		sub := *req
+		sub.URL = &u
+		handler.ServeHTTP(res, &sub)
+	}
+	r.addRoute("*", prefix, []Handler{mount})
+	below := r.addRoute("*", prefix+"/*"+mountParam, []Handler{mount})
+	r.routesLock.Lock()
+	below.mounted = true
+	r.routesLock.Unlock()
+}
+
+func (r *router) Handle(res http.ResponseWriter, req *http.Request, context Context) {
+	bestMatch, bestVals, bestRoute := r.matchRoute(req.Method, req.URL.Path, r.redirectTrailingSlash)
+
+	// only the other form of the path is routed: redirect to it
+	if bestMatch == NoMatch && r.redirectTrailingSlash {
+		if path, ok := toggleTrailingSlash(req.URL.Path); ok {
+			if match, _, _ := r.matchRoute(req.Method, path, true); match != NoMatch {
+				code := http.StatusMovedPermanently
+				if req.Method != "GET" && req.Method != "HEAD" {
+					// keep the method and body
+					code = http.StatusPermanentRedirect
+				}
+				dest := url.URL{Path: path, RawQuery: req.URL.RawQuery}
+				http.Redirect(res, req, withBasePath(context, req, dest.String()), code)
+				return
 			}
 		}
 	}
@@ -135,18 +246,92 @@ func (r *router) Handle(res http.ResponseWriter, req *http.Request, context Cont
 	if bestMatch != NoMatch {
 		params := Params(bestVals)
 		context.Map(params)
+		if bestMatch == OverloadMatch && req.Method == "HEAD" {
+			// a GET route answers the HEAD request, without writing the body
+			rv := context.Get(inject.InterfaceOf((*http.ResponseWriter)(nil)))
+			rw, ok := rv.Interface().(ResponseWriter)
+			if !ok {
+				rw = NewResponseWriter(rv.Interface().(http.ResponseWriter))
+			}
+			context.MapTo(headResponseWriter{rw}, (*http.ResponseWriter)(nil))
+		}
 		bestRoute.Handle(context, res) //其实就是建立一个路由上下文,routeContext，注入context和路由规则，然后run
 		return
 	}
 
+	// the path exists for other methods: answer OPTIONS with the allowed methods, 405 otherwise
+	if methods := r.MethodsFor(req.URL.Path); len(methods) > 0 {
+		res.Header().Set("Allow", strings.Join(allowedMethods(methods), ","))
+		if req.Method == "OPTIONS" {
+			res.WriteHeader(http.StatusOK)
+			return
+		}
+		handlers := r.notAlloweds
+		if r.customNotFound && !r.customNotAllowed {
+			handlers = r.notFounds
+		}
+		c := &routeContext{context, 0, handlers}
+		context.MapTo(c, (*Context)(nil))
+		c.run()
+		return
+	}
+
 	// no routes exist, 404
 	c := &routeContext{context, 0, r.notFounds}
 	context.MapTo(c, (*Context)(nil))
 	c.run() // 设置上下文为notfounds方法
 }
 
+func (r *router) RedirectTrailingSlash(enabled bool) {
+	r.redirectTrailingSlash = enabled
+}
+
+// matchRoute returns the route that best matches the method and path, along with its params.
+func (r *router) matchRoute(method string, path string, strict bool) (RouteMatch, map[string]string, *route) {
+	bestMatch := NoMatch
+	var bestVals map[string]string
+	var bestRoute *route
+
+	// 查找最match的路由规则
+	for _, route := range r.candidateRoutes(path) {
+		var match RouteMatch
+		var vals map[string]string
+		if strict {
+			match, vals = route.matchStrict(method, path)
+		} else {
+			match, vals = route.Match(method, path)
+		}
+		if match.BetterThan(bestMatch) {
+			bestMatch = match
+			bestVals = vals
+			bestRoute = route
+			if match == ExactMatch {
+				break
+			}
+		}
+	}
+	return bestMatch, bestVals, bestRoute
+}
+
+// toggleTrailingSlash adds a trailing slash to the path, or removes it if it has one.
+func toggleTrailingSlash(path string) (string, bool) {
+	if path == "/" || path == "" {
+		return "", false
+	}
+	if strings.HasSuffix(path, "/") {
+		return path[:len(path)-1], true
+	}
+	return path + "/", true
+}
+
 func (r *router) NotFound(handler ...Handler) {
 	r.notFounds = handler
+	r.customNotFound = true
+}
+
+func (r *router) MethodNotAllowed(handler ...Handler) {
+	r.notAlloweds = handler
+	r.customNotAllowed = true
 }
 
 func (r *router) addRoute(method string, pattern string, handlers []Handler) *route {
@@ -165,6 +350,11 @@ func (r *router) addRoute(method string, pattern string, handlers []Handler) *ro
 
 	route := newRoute(method, pattern, handlers) //根据加入的pattern来新建路由规则
 	route.Validate()
+	if r.validate != nil {
+		for _, handler := range route.handlers {
+			r.validate(handler)
+		}
+	}
 	r.appendRoute(route) //将新生成的路由规则加入路由表
 	return route
 }
@@ -172,6 +362,7 @@ func (r *router) addRoute(method string, pattern string, handlers []Handler) *ro
 func (r *router) appendRoute(rt *route) {
 	r.routesLock.Lock()
 	defer r.routesLock.Unlock()
+	r.tree.insert(treeSegments(rt.pattern), len(r.routes))
 	r.routes = append(r.routes, rt)
 }
 
@@ -181,6 +372,18 @@ func (r *router) getRoutes() []*route {
 	return r.routes[:]
 }
 
+// candidateRoutes returns the routes that may match path, in the order they were added.
+func (r *router) candidateRoutes(path string) []*route {
+	r.routesLock.RLock()
+	defer r.routesLock.RUnlock()
+	indexes := r.tree.lookup(path)
+	routes := make([]*route, len(indexes))
+	for i, index := range indexes {
+		routes[i] = r.routes[index]
+	}
+	return routes
+}
+
 func (r *router) findRoute(name string) *route {
 	for _, route := range r.getRoutes() {
 		if route.name == name {
@@ -192,6 +395,8 @@ func (r *router) findRoute(name string) *route {
 }
 
 // Route is an interface representing a Route in Martini's routing layer.
+// The matched Route is mapped into the request context before its handlers run, so handlers can request it
+// and middleware can look it up after calling Next. No Route is mapped when no route matches the request.
 type Route interface {
 	// URLWith returns a rendering of the Route's url with the given string params.
 	URLWith([]string) string
@@ -206,26 +411,52 @@ type Route interface {
 }
 
 type route struct {
-	method   string
-	regex    *regexp.Regexp
-	handlers []Handler
+	method      string
+	regex       *regexp.Regexp
+	strictRegex *regexp.Regexp // regex without the optional trailing slash
+	handlers    []Handler
 	pattern  string
 	name     string
+	methods  []string // the methods the route was declared with, several for Match
+	mounted  bool     // the catch-all route below a Mount prefix, left out of RouteInfos
 }
 
-var routeReg1 = regexp.MustCompile(`:[^/#?()\.\\]+`)
+// routeReg1 matches named params, optionally followed by a regex constraint such as `:id(\d+)`.
+// The constraint may itself hold one level of groups, e.g. `:id(\d+|(new|edit))`.
+var routeReg1 = regexp.MustCompile(`:([^/#?()\.\\]+)(\((?:[^()]|\([^()]*\))*\))?`)
 var routeReg2 = regexp.MustCompile(`\*\*`)
 
+// catchAllReg matches a catch-all param such as `/*filepath`, which is only allowed as the last segment.
+var catchAllReg = regexp.MustCompile(`/\*([^/#?()\.\\*]+)`)
+
 func newRoute(method string, pattern string, handlers []Handler) *route {
-	route := route{method, nil, handlers, pattern, ""}
+	route := route{method, nil, nil, handlers, pattern, "", []string{method}, false}
+	var catchAll string
+	if locs := catchAllReg.FindAllStringSubmatchIndex(pattern, -1); len(locs) > 0 {
+		if len(locs) > 1 || locs[0][1] != len(pattern) {
+			panic(fmt.Sprintf("martini: catch-all param in route %s must be the last segment", pattern))
+		}
+		catchAll = pattern[locs[0][2]:locs[0][3]]
+		pattern = pattern[:locs[0][0]]
+	}
 	pattern = routeReg1.ReplaceAllStringFunc(pattern, func(m string) string {
-		return fmt.Sprintf(`(?P<%s>[^/#?]+)`, m[1:])
+		sub := routeReg1.FindStringSubmatch(m)
+		if sub[2] != "" {
+			// the param only matches when the captured segment satisfies the constraint
+			return fmt.Sprintf(`(?P<%s>%s)`, sub[1], sub[2][1:len(sub[2])-1])
+		}
+		return fmt.Sprintf(`(?P<%s>[^/#?]+)`, sub[1])
 	})
 	var index int
 	pattern = routeReg2.ReplaceAllStringFunc(pattern, func(m string) string {
 		index++
 		return fmt.Sprintf(`(?P<_%d>[^#?]*)`, index)
 	})
+	if catchAll != "" {
+		// the rest of the path, slashes included
+		pattern += fmt.Sprintf(`/(?P<%s>[^#?]*)`, catchAll)
+	}
+	route.strictRegex = regexp.MustCompile(pattern)
 	pattern += `\/?`
 	route.regex = regexp.MustCompile(pattern)
 	return &route
@@ -259,16 +490,25 @@ func (r route) MatchMethod(method string) RouteMatch {
 }
 
 func (r route) Match(method string, path string) (RouteMatch, map[string]string) {
+	return r.match(r.regex, method, path)
+}
+
+// matchStrict is like Match, except that a trailing slash in the path is only matched by a trailing slash in the pattern.
+func (r route) matchStrict(method string, path string) (RouteMatch, map[string]string) {
+	return r.match(r.strictRegex, method, path)
+}
+
+func (r route) match(regex *regexp.Regexp, method string, path string) (RouteMatch, map[string]string) {
 	// add Any method matching support
 	match := r.MatchMethod(method)
 	if match == NoMatch {
 		return match, nil
 	}
 
-	matches := r.regex.FindStringSubmatch(path)
+	matches := regex.FindStringSubmatch(path)
 	if len(matches) > 0 && matches[0] == path {
 		params := make(map[string]string)
-		for i, name := range r.regex.SubexpNames() {
+		for i, name := range regex.SubexpNames() {
 			if len(name) > 0 {
 				params[name] = matches[i]
 			}
@@ -288,10 +528,11 @@ func (r *route) Handle(c Context, res http.ResponseWriter) {
 	context := &routeContext{c, 0, r.handlers}
 	c.MapTo(context, (*Context)(nil))
 	c.MapTo(r, (*Route)(nil))
+	c.Map(RouteMeta{append([]string(nil), r.methods...), r.pattern, r.name})
 	context.run()
 }
 
-var urlReg = regexp.MustCompile(`:[^/#?()\.\\]+|\(\?P<[a-zA-Z0-9]+>.*\)`)
+var urlReg = regexp.MustCompile(`:[^/#?()\.\\]+(?:\((?:[^()]|\([^()]*\))*\))?|\(\?P<[a-zA-Z0-9]+>.*\)|\*\*|\*[^/#?()\.\\*]+`)
 
 // URLWith returns the url pattern replacing the parameters for its values
 func (r *route) URLWith(args []string) string {
@@ -332,12 +573,35 @@ func (r *route) Method() string {
 
 // Routes is a helper service for Martini's routing layer.
 type Routes interface {
-	// URLFor returns a rendered URL for the given route. Optional params can be passed to fulfill named parameters in the route.
+	// URLFor returns a rendered URL for the given route. Params fulfill the named parameters and wildcards in the route, in order.
+	// Will panic if the route does not exist or if fewer params than the route requires are passed.
 	URLFor(name string, params ...interface{}) string
 	// MethodsFor returns an array of methods available for the path
 	MethodsFor(path string) []string
 	// All returns an array with all the routes in the router.
 	All() []Route
+	// RouteInfos describes all the routes in the router, in the order they were added, such as for a route table.
+	// Patterns include the patterns of the groups the routes were added in. A sub-app added with Mount is listed
+	// once, with the method "*" and its prefix as the pattern.
+	RouteInfos() []RouteInfo
+}
+
+// RouteInfo describes a route, as listed by Routes.RouteInfos.
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Name    string `json:"name,omitempty"`
+}
+
+// RouteMeta describes the route a request matched. It is mapped before the route's handlers run, so that
+// middleware can tell the route apart from the raw request, such as to instrument it by pattern.
+type RouteMeta struct {
+	// Methods the route was declared with: a single one, "*" for Any, or those passed to Match.
+	Methods []string
+	// Pattern, including the patterns of the groups the route was added in.
+	Pattern string
+	// Name given to the route, if any.
+	Name string
 }
 
 // URLFor returns the url for the given route name.
@@ -362,7 +626,14 @@ func (r *router) URLFor(name string, params ...interface{}) string {
 		}
 	}
 
-	return route.URLWith(args)
+	if required := len(urlReg.FindAllString(route.pattern, -1)); len(args) < required {
+		panic(fmt.Sprintf("route %s requires %d params, got %d", name, required, len(args)))
+	}
+
+	r.routesLock.RLock()
+	prefix := r.basePath
+	r.routesLock.RUnlock()
+	return prefix + route.URLWith(args)
 }
 
 func (r *router) All() []Route {
@@ -376,6 +647,19 @@ func (r *router) All() []Route {
 	return ri
 }
 
+func (r *router) RouteInfos() []RouteInfo {
+	r.routesLock.RLock()
+	defer r.routesLock.RUnlock()
+	infos := make([]RouteInfo, 0, len(r.routes))
+	for _, route := range r.routes {
+		// a Mount is listed once, as its prefix
+		if !route.mounted {
+			infos = append(infos, RouteInfo{route.method, route.pattern, route.name})
+		}
+	}
+	return infos
+}
+
 func hasMethod(methods []string, method string) bool {
 	for _, v := range methods {
 		if v == method {
@@ -385,10 +669,23 @@ func hasMethod(methods []string, method string) bool {
 	return false
 }
 
+// allowedMethods returns the methods of the Allow header for a path routed for methods: those, along with HEAD
+// when GET routes answer it and OPTIONS, answered automatically.
+func allowedMethods(methods []string) []string {
+	allowed := append([]string(nil), methods...)
+	if hasMethod(allowed, "GET") && !hasMethod(allowed, "HEAD") {
+		allowed = append(allowed, "HEAD")
+	}
+	if !hasMethod(allowed, "OPTIONS") {
+		allowed = append(allowed, "OPTIONS")
+	}
+	return allowed
+}
+
 // MethodsFor returns all methods available for path
 func (r *router) MethodsFor(path string) []string {
 	methods := []string{}
-	for _, route := range r.getRoutes() {
+	for _, route := range r.candidateRoutes(path) {
 		matches := route.regex.FindStringSubmatch(path)
 		if len(matches) > 0 && matches[0] == path && !hasMethod(methods, route.method) {
 			methods = append(methods, route.method)
@@ -397,6 +694,19 @@ func (r *router) MethodsFor(path string) []string {
 	return methods
 }
 
+// headResponseWriter discards the body a GET handler writes in answer to a HEAD request,
+// while keeping its headers and status.
+type headResponseWriter struct {
+	ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	if !w.Written() {
+		w.WriteHeader(http.StatusOK)
+	}
+	return len(b), nil
+}
+
 type routeContext struct {
 	Context
 	index    int
@@ -408,23 +718,59 @@ func (r *routeContext) Next() {
 	r.run()
 }
 
+func (r *routeContext) RunFrom(index int) {
+	validateHandlerIndex(index, len(r.handlers)-1)
+	if r.Written() {
+		return
+	}
+	r.index = index
+	r.run()
+}
+
+func (r *routeContext) HandlerIndex() int {
+	return r.index
+}
+
+func (r *routeContext) HandlerCount() int {
+	return len(r.handlers)
+}
+
+func (r *routeContext) NextE() error {
+	return catchInvokeError(r.Next)
+}
+
+func (r *routeContext) Abort() {
+	r.index = len(r.handlers)
+	r.Context.Abort()
+}
+
+func (r *routeContext) AbortWithStatus(status int) {
+	r.index = len(r.handlers)
+	r.Context.AbortWithStatus(status)
+}
+
 
 
 func (r *routeContext) run() {
 	for r.index < len(r.handlers) {
 		handler := r.handlers[r.index]
-		vals, err := r.Invoke(handler)
+		written := r.Written()
+		vals, err := invoke(r, handler)
 		if err != nil {
-			panic(err)
+			panic(newChainInvokeError(err, handler, r.index, len(r.handlers), "of the route"))
 		}
 		r.index += 1
 
-		// if the handler returned something, write it to the http response
-		if len(vals) > 0 {
+		// if the handler returned something, write it to the http response, unless it had been written
+		// before the handler even ran
+		if len(vals) > 0 && !written {
 			//返回值函数
-			ev := r.Get(reflect.TypeOf(ReturnHandler(nil))) ) // ReturnHandler这个类型就是刚开始 martini.New() 中设置的 defaultReturnHandler()
-			handleReturn := ev.Interface().(ReturnHandler)
-			handleReturn(r, vals)
+			ev := r.Get(reflect.TypeOf(ReturnHandler(nil))) // ReturnHandler这个类型就是刚开始 martini.New() 中设置的 defaultReturnHandler()
+			// without a ReturnHandler, return values are ignored
+			if ev.IsValid() && !ev.IsNil() {
+				handleReturn := ev.Interface().(ReturnHandler)
+				handleReturn(r, vals)
+			}
 		}
 
 
@@ -432,5 +778,8 @@ func (r *routeContext) run() {
 		if r.Written() {
 			return
 		}
+		if abortDoneRequest(r) {
+			return
+		}
 	}
 }
@@ -1,10 +1,16 @@
 package martini
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/codegangsta/inject"
 )
 
 func Test_Routing(t *testing.T) {
@@ -195,6 +201,452 @@ func Test_RouterHandlerStatusCode(t *testing.T) {
 	expect(t, recorder.Body.String(), "Interface!")
 }
 
+type returnedPoint struct {
+	X, Y int
+}
+
+func Test_RouterReturnSignatures(t *testing.T) {
+	served := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusAccepted)
+		io.WriteString(res, "served "+req.URL.Path)
+	})
+
+	for _, c := range []struct {
+		name    string
+		handler Handler
+		json    bool
+		code    int
+		body    string
+		header  string
+	}{
+		{"string", func() string { return "foo" }, false, http.StatusOK, "foo", ""},
+		{"bytes", func() []byte { return []byte("foo") }, false, http.StatusOK, "foo", ""},
+		{"status", func() int { return http.StatusNoContent }, false, http.StatusNoContent, "", ""},
+		{"status of another integer type", func() uint16 { return http.StatusNoContent }, false, http.StatusNoContent, "", ""},
+		{"status and string", func() (int, string) { return http.StatusCreated, "foo" }, false, http.StatusCreated, "foo", ""},
+		{"status and bytes", func() (int, []byte) { return http.StatusCreated, []byte("foo") }, false, http.StatusCreated, "foo", ""},
+		{"status, headers and body", func() (int, map[string]string, string) {
+			return http.StatusCreated, map[string]string{"X-Test": "yes"}, "foo"
+		}, false, http.StatusCreated, "foo", "yes"},
+		{"body and nil error", func() (string, error) { return "foo", nil }, false, http.StatusOK, "foo", ""},
+		{"body and error", func() (string, error) { return "foo", errors.New("failed") }, false, http.StatusInternalServerError, "failed\n", ""},
+		{"status, body and error", func() (int, string, error) {
+			return http.StatusBadRequest, "foo", errors.New("bad input")
+		}, false, http.StatusBadRequest, "bad input\n", ""},
+		{"status and error", func() (int, error) { return http.StatusConflict, errors.New("taken") }, false, http.StatusConflict, "taken\n", ""},
+		{"status, headers, body and error", func() (int, http.Header, string, error) {
+			return http.StatusCreated, http.Header{"X-Test": {"yes"}}, "foo", nil
+		}, false, http.StatusCreated, "foo", "yes"},
+		{"reader", func() io.Reader { return strings.NewReader("streamed") }, false, http.StatusOK, "streamed", ""},
+		{"status and reader", func() (int, io.Reader) { return http.StatusCreated, strings.NewReader("streamed") }, false, http.StatusCreated, "streamed", ""},
+		{"http.Handler", func() http.Handler { return served }, false, http.StatusAccepted, "served /", ""},
+		{"nil body", func() (int, *returnedPoint) { return http.StatusNotFound, nil }, false, http.StatusNotFound, "", ""},
+		{"other value", func() returnedPoint { return returnedPoint{1, 2} }, false, http.StatusOK, "{1 2}", ""},
+		{"struct as JSON", func() returnedPoint { return returnedPoint{1, 2} }, true, http.StatusOK, `{"X":1,"Y":2}`, ""},
+		{"status and struct as JSON", func() (int, *returnedPoint, error) {
+			return http.StatusCreated, &returnedPoint{1, 2}, nil
+		}, true, http.StatusCreated, `{"X":1,"Y":2}`, ""},
+		{"string with JSON", func() string { return "foo" }, true, http.StatusOK, "foo", ""},
+		{"pointer in an interface as JSON", func() (interface{}, error) {
+			return &returnedPoint{1, 2}, nil
+		}, true, http.StatusOK, `{"X":1,"Y":2}`, ""},
+		{"nil pointer in an interface", func() (int, interface{}) {
+			return http.StatusNotFound, (*returnedPoint)(nil)
+		}, true, http.StatusNotFound, "", ""},
+	} {
+		m := Classic()
+		if c.json {
+			m.Map(JSONReturnHandler())
+		}
+		m.Get("/", c.handler)
+
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+		m.ServeHTTP(recorder, req)
+		if recorder.Code != c.code || recorder.Body.String() != c.body || recorder.HeaderMap.Get("X-Test") != c.header {
+			t.Errorf("%s: got %d %q (X-Test %q), expected %d %q (X-Test %q)", c.name,
+				recorder.Code, recorder.Body.String(), recorder.HeaderMap.Get("X-Test"), c.code, c.body, c.header)
+		}
+	}
+}
+
+func Test_RouterHandlerError(t *testing.T) {
+	router := NewRouter()
+	router.Get("/error", func() (string, error) {
+		return "foo", errors.New("something went wrong")
+	})
+	router.Get("/status", func() (int, string, error) {
+		return http.StatusBadRequest, "foo", errors.New("bad input")
+	})
+	router.Get("/nil", func() (string, error) {
+		return "foo", nil
+	})
+	router.Get("/only", func() error {
+		return nil
+	})
+	router.Get("/created", func() (int, error) {
+		return http.StatusCreated, nil
+	})
+
+	// a non nil error is answered with a 500
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/error", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Body.String(), "something went wrong\n")
+
+	// unless a status code precedes it
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/status", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusBadRequest)
+	expect(t, recorder.Body.String(), "bad input\n")
+
+	// a nil error is ignored
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/nil", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "foo")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/only", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, context.Written(), false)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/created", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusCreated)
+	expect(t, recorder.Body.String(), "")
+}
+
+func Test_RouterHandlerHeaders(t *testing.T) {
+	router := NewRouter()
+	router.Get("/header", func() (int, http.Header, string) {
+		return http.StatusCreated, http.Header{"Content-Type": {"text/csv"}, "X-Tags": {"a", "b"}}, "a,b"
+	})
+	router.Get("/map", func() (int, map[string]string, []byte, error) {
+		return http.StatusOK, map[string]string{"cache-control": "max-age=60"}, []byte("cached"), nil
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/header", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusCreated)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "text/csv")
+	expect(t, strings.Join(recorder.HeaderMap["X-Tags"], ","), "a,b")
+	expect(t, recorder.Body.String(), "a,b")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/map", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.HeaderMap.Get("Cache-Control"), "max-age=60")
+	expect(t, recorder.Body.String(), "cached")
+}
+
+func Test_RouterHandlerJSON(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	router := NewRouter()
+	router.Get("/struct", func() (int, *user) {
+		return http.StatusCreated, &user{"jeremy"}
+	})
+	router.Get("/map", func(res http.ResponseWriter) map[string]int {
+		res.Header().Set("Content-Type", "application/vnd.api+json")
+		return map[string]int{"count": 2}
+	})
+	router.Get("/string", func() string {
+		return "plain"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/struct", nil)
+	context := New().createContext(recorder, req)
+	context.Map(JSONReturnHandler())
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusCreated)
+	expect(t, recorder.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	expect(t, recorder.Body.String(), `{"name":"jeremy"}`)
+
+	// an existing Content-Type is kept
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/map", nil)
+	context = New().createContext(recorder, req)
+	context.Map(JSONReturnHandler())
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Header().Get("Content-Type"), "application/vnd.api+json")
+	expect(t, recorder.Body.String(), `{"count":2}`)
+
+	// strings are written as they are
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/string", nil)
+	context = New().createContext(recorder, req)
+	context.Map(JSONReturnHandler())
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Header().Get("Content-Type"), "")
+	expect(t, recorder.Body.String(), "plain")
+}
+
+func Test_RouterReturnHandlerPerGroup(t *testing.T) {
+	m := Classic()
+	m.Group("/api", func(r Router) {
+		r.Get("/user", func() map[string]string {
+			return map[string]string{"name": "jeremy"}
+		})
+	}, func(c Context) {
+		c.Map(JSONReturnHandler())
+	})
+	m.Get("/user", func() []byte {
+		return []byte("jeremy")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/api/user", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), `{"name":"jeremy"}`)
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "application/json; charset=utf-8")
+
+	// other routes keep the default
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/user", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "jeremy")
+	expect(t, recorder.HeaderMap.Get("Content-Type"), "")
+}
+
+func Test_RouterHandlerReturnsHandler(t *testing.T) {
+	router := NewRouter()
+	router.Get("/handler", func() http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(http.StatusAccepted)
+			res.Write([]byte("served " + req.URL.Path))
+		})
+	})
+	router.Get("/redirect", func() http.Handler {
+		return http.RedirectHandler("/handler", http.StatusFound)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/handler", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusAccepted)
+	expect(t, recorder.Body.String(), "served /handler")
+	expect(t, context.Written(), true)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/redirect", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusFound)
+	expect(t, recorder.Header().Get("Location"), "/handler")
+}
+
+type closingReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (r *closingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func Test_RouterHandlerReturnsReader(t *testing.T) {
+	reader := &closingReader{Reader: strings.NewReader("streamed body")}
+	router := NewRouter()
+	router.Get("/reader", func() (int, io.Reader) {
+		return http.StatusCreated, reader
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/reader", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusCreated)
+	expect(t, recorder.Body.String(), "streamed body")
+	expect(t, reader.closed, true)
+}
+
+func Test_RouterHandlerReturnsNil(t *testing.T) {
+	router := NewRouter()
+	router.Get("/nil", func() interface{} {
+		return nil
+	})
+	router.Get("/status", func() (int, *string) {
+		return http.StatusNoContent, nil
+	})
+	router.Get("/written", func(res http.ResponseWriter) string {
+		res.WriteHeader(http.StatusAccepted)
+		res.Write([]byte("written"))
+		return "returned"
+	})
+
+	for path, want := range map[string]int{"/nil": http.StatusOK, "/status": http.StatusNoContent} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+path, nil)
+		context := New().createContext(recorder, req)
+		router.Handle(recorder, req, context)
+		expect(t, recorder.Code, want)
+		expect(t, recorder.Body.String(), "")
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/written", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusAccepted)
+	expect(t, recorder.Body.String(), "written")
+}
+
+func Test_RouterHandlerAfterWritten(t *testing.T) {
+	router := NewRouter()
+	next := func() string {
+		return "not written"
+	}
+	router.Get("/stream", func(c Context, res http.ResponseWriter) {
+		res.Write([]byte("chunk 1\n"))
+		res.(http.Flusher).Flush()
+		c.Next()
+		res.Write([]byte("chunk 2\n"))
+	}, next)
+	router.Get("/redirect", func(c Context, res http.ResponseWriter, req *http.Request) {
+		http.Redirect(res, req, "/login", http.StatusFound)
+		c.Next()
+	}, next)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/stream", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Body.String(), "chunk 1\nchunk 2\n")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/redirect", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusFound)
+	expect(t, recorder.Header().Get("Location"), "/login")
+	expect(t, strings.Contains(recorder.Body.String(), "not written"), false)
+
+	// custom return handlers are skipped too
+	called := false
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/redirect", nil)
+	context = New().createContext(recorder, req)
+	context.Map(ReturnHandler(func(Context, []reflect.Value) {
+		called = true
+	}))
+	router.Handle(recorder, req, context)
+	expect(t, called, false)
+}
+
+func Test_RouterNilReturnHandler(t *testing.T) {
+	m := Classic()
+	m.Map(ReturnHandler(nil))
+	m.Get("/", func(res http.ResponseWriter) string {
+		res.Write([]byte("written"))
+		return "ignored"
+	}, func() string {
+		return "ignored too"
+	})
+	m.Get("/returns", func() (int, string) {
+		return http.StatusCreated, "ignored"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "written")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/returns", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "")
+}
+
+func Test_RouterHandlerRunFrom(t *testing.T) {
+	result := ""
+	m := Classic()
+	m.Get("/", func(c Context) {
+		c.Next()
+		c.RunFrom(1)
+	}, func() {
+		result += "replayed"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, result, "replayedreplayed")
+}
+
+func Test_RouterHandlerIndex(t *testing.T) {
+	m := Classic()
+	m.Get("/", func(c Context) {
+		expect(t, c.HandlerIndex(), 0)
+		expect(t, c.HandlerCount(), 2)
+	}, func(c Context) string {
+		return strconv.Itoa(c.HandlerIndex()) + "/" + strconv.Itoa(c.HandlerCount())
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "1/2")
+}
+
+func Test_RouterParamsInjection(t *testing.T) {
+	m := Classic()
+	m.Get("/users/:id/posts/:post", func(params Params) {
+		// route middleware sees the params too
+		expect(t, params["id"], "1")
+	}, func(params Params) string {
+		return params["id"] + "/" + params["post"]
+	})
+	m.Get("/about", func(params Params) string {
+		refute(t, params, nil)
+		return strconv.Itoa(len(params))
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users/1/posts/hello", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "1/hello")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/about", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "0")
+}
+
+func Test_RouterHandlerNextE(t *testing.T) {
+	m := Classic()
+	var nextErr error
+	m.Get("/foo", func(c Context) {
+		nextErr = c.NextE()
+	}, func(s []int) string {
+		return "unreachable"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo", nil)
+	m.ServeHTTP(recorder, req)
+	refute(t, nextErr, nil)
+	expect(t, recorder.Body.String(), "")
+}
+
 func Test_RouterHandlerStacking(t *testing.T) {
 	router := NewRouter()
 	recorder := httptest.NewRecorder()
@@ -230,6 +682,80 @@ func Test_RouterHandlerStacking(t *testing.T) {
 	expect(t, recorder.Body.String(), "Hello world")
 }
 
+func Test_RouterHandlerAbort(t *testing.T) {
+	router := NewRouter()
+	recorder := httptest.NewRecorder()
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/foo", nil)
+	context := New().createContext(recorder, req)
+
+	result := ""
+	router.Get("/foo", func(c Context) {
+		result += "foo"
+		c.AbortWithStatus(http.StatusForbidden)
+	}, func() string {
+		result += "bar"
+		return "bar"
+	})
+
+	router.Handle(recorder, req, context)
+	expect(t, result, "foo")
+	expect(t, recorder.Code, http.StatusForbidden)
+	expect(t, recorder.Body.String(), "")
+}
+
+func Test_RouterPerRouteMiddleware(t *testing.T) {
+	m := Classic()
+	result := ""
+	m.Use(func(c Context) {
+		result += "global-"
+		c.Next()
+		result += "-global"
+	})
+
+	auth := func(c Context, req *http.Request) {
+		result += "auth-"
+		if req.Header.Get("Authorization") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Map("admin")
+		c.Next()
+		result += "-auth"
+	}
+	m.Get("/admin", auth, func(user string) string {
+		result += user
+		return "hello " + user
+	})
+	m.Get("/public", func() string {
+		result += "public"
+		return "hello"
+	})
+
+	// middleware runs only for its route
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/public", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, result, "global-public-global")
+	expect(t, recorder.Body.String(), "hello")
+
+	// and short-circuits like global middleware
+	result = ""
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/admin", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, result, "global-auth--global")
+	expect(t, recorder.Code, http.StatusUnauthorized)
+
+	result = ""
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/admin", nil)
+	req.Header.Set("Authorization", "secret")
+	m.ServeHTTP(recorder, req)
+	expect(t, result, "global-auth-admin-auth-global")
+	expect(t, recorder.Body.String(), "hello admin")
+}
+
 var routeTests = []struct {
 	// in
 	method string
@@ -288,6 +814,151 @@ func Test_MethodsFor(t *testing.T) {
 	router.Handle(recorder, req, context)
 	expect(t, recorder.Code, http.StatusMethodNotAllowed)
 	expect(t, recorder.Header().Get("Allow"), "GET,PUT")
+
+	// MethodNotAllowed takes those requests over from NotFound
+	router.MethodNotAllowed(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusTeapot)
+	})
+	recorder = httptest.NewRecorder()
+	context = New().createContext(recorder, req)
+	context.MapTo(router, (*Routes)(nil))
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusTeapot)
+	expect(t, recorder.Header().Get("Allow"), "GET,PUT,HEAD,OPTIONS")
+}
+
+func Test_HeadOnGetRoute(t *testing.T) {
+	router := NewRouter()
+	router.Get("/foo", func(res http.ResponseWriter) string {
+		res.Header().Set("X-Foo", "bar")
+		return "foo"
+	})
+	router.Get("/bar", func() string {
+		return "bar"
+	})
+	router.Head("/bar", func(res http.ResponseWriter) {
+		res.Header().Set("X-Explicit", "true")
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("HEAD", "http://localhost:3000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get("X-Foo"), "bar")
+	expect(t, recorder.Body.String(), "")
+
+	// an explicit HEAD route takes precedence over the GET one
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("HEAD", "http://localhost:3000/bar", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusNoContent)
+	expect(t, recorder.Header().Get("X-Explicit"), "true")
+}
+
+func Test_RedirectTrailingSlash(t *testing.T) {
+	router := NewRouter()
+	router.RedirectTrailingSlash(true)
+	router.Get("/users", func() string {
+		return "users"
+	})
+	router.Post("/posts/", func() string {
+		return "posts"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users/?page=2", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusMovedPermanently)
+	expect(t, recorder.Header().Get("Location"), "/users?page=2")
+
+	// the method is kept for non GET requests
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "http://localhost:3000/posts", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusPermanentRedirect)
+	expect(t, recorder.Header().Get("Location"), "/posts/")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/users", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "users")
+
+	// both forms match when disabled
+	router.RedirectTrailingSlash(false)
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/users/", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "users")
+}
+
+func Test_MethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+	router.Get("/foo", func() {})
+	router.Delete("/foo", func() {})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost:3000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+
+	expect(t, recorder.Code, http.StatusMethodNotAllowed)
+	expect(t, recorder.Header().Get("Allow"), "GET,DELETE,HEAD,OPTIONS")
+}
+
+func Test_MethodNotAllowedHandlers(t *testing.T) {
+	router := NewRouter()
+	router.Get("/foo", func() {})
+	router.MethodNotAllowed(func(res http.ResponseWriter) {
+		res.Header().Set("Content-Type", "application/json")
+	}, func() (int, string) {
+		return http.StatusMethodNotAllowed, `{"error":"method not allowed"}`
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost:3000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+
+	expect(t, recorder.Code, http.StatusMethodNotAllowed)
+	expect(t, recorder.Header().Get("Allow"), "GET,HEAD,OPTIONS")
+	expect(t, recorder.Header().Get("Content-Type"), "application/json")
+	expect(t, recorder.Body.String(), `{"error":"method not allowed"}`)
+}
+
+func Test_AutomaticOptions(t *testing.T) {
+	router := NewRouter()
+	router.Get("/foo", func() {})
+	router.Put("/foo", func() {})
+	router.Get("/bar", func() {})
+	router.Options("/bar", func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "http://localhost:3000/foo", nil)
+	context := New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get("Allow"), "GET,PUT,HEAD,OPTIONS")
+
+	// a registered OPTIONS route takes precedence
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "http://localhost:3000/bar", nil)
+	context = New().createContext(recorder, req)
+	router.Handle(recorder, req, context)
+
+	expect(t, recorder.Code, http.StatusNoContent)
+	expect(t, recorder.Header().Get("Allow"), "")
 }
 
 func Test_NotFound(t *testing.T) {
@@ -404,6 +1075,71 @@ func Test_Any(t *testing.T) {
 	expect(t, recorder.Body.String(), "Nope\n")
 }
 
+func Test_Match(t *testing.T) {
+	m := Classic()
+	routes := m.Match([]string{"GET", "put"}, "/items/:id", func(req *http.Request, params Params) string {
+		return req.Method + " " + params["id"]
+	})
+	expect(t, len(routes), 2)
+	expect(t, routes[1].Method(), "PUT")
+
+	for _, method := range []string{"GET", "PUT"} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "http://localhost:3000/items/3", nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Body.String(), method+" 3")
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "http://localhost:3000/items/3", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusMethodNotAllowed)
+	expect(t, recorder.HeaderMap.Get("Allow"), "GET,PUT,HEAD,OPTIONS")
+}
+
+func Test_RouteMeta(t *testing.T) {
+	var metas []RouteMeta
+	record := func(meta RouteMeta) {
+		metas = append(metas, meta)
+	}
+	m := Classic()
+	m.Group("/api", func(r Router) {
+		r.Get("/users/:id", record, func() {}).Name("user")
+		r.Any("/any", record, func() {})
+		r.Match([]string{"post", "put"}, "/items", record, func() {})
+	})
+
+	for _, r := range []struct{ method, path string }{{"GET", "/api/users/1"}, {"DELETE", "/api/any"}, {"PUT", "/api/items"}} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, "http://localhost:3000"+r.path, nil)
+		m.ServeHTTP(recorder, req)
+	}
+
+	expect(t, len(metas), 3)
+	expect(t, strings.Join(metas[0].Methods, ","), "GET")
+	expect(t, metas[0].Pattern, "/api/users/:id")
+	expect(t, metas[0].Name, "user")
+	expect(t, strings.Join(metas[1].Methods, ","), "*")
+	expect(t, strings.Join(metas[2].Methods, ","), "POST,PUT")
+	expect(t, metas[2].Pattern, "/api/items")
+}
+
+func Test_AddRoutes(t *testing.T) {
+	m := Classic()
+	routes := m.AddRoutes("GET", []string{"/", "/home"}, func(req *http.Request) string {
+		return "home at " + req.URL.Path
+	})
+	expect(t, len(routes), 2)
+	expect(t, routes[1].Pattern(), "/home")
+
+	for _, path := range []string{"/", "/home"} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Body.String(), "home at "+path)
+	}
+}
+
 func Test_URLFor(t *testing.T) {
 	router := NewRouter()
 
@@ -424,8 +1160,23 @@ func Test_URLFor(t *testing.T) {
 		expect(t, routes.URLFor("bar", 5), "/bar/5")
 		expect(t, routes.URLFor("baz_id", 5, "john"), "/baz/5/john")
 		expect(t, routes.URLFor("bar_id", 5, "john"), "/bar/5/john")
+		expect(t, routes.URLFor("files", "docs/readme.md", 2), "/files/docs/readme.md/rev/2")
+		expect(t, routes.URLFor("user", 5), "/users/5")
+		expect(t, routes.URLFor("download", "a/b.txt"), "/download/a/b.txt")
 	}).Name("bar_id")
 
+	router.Get("/users/:id(\\d+)", func() {
+		// Nothing
+	}).Name("user")
+
+	router.Get("/download/*filepath", func() {
+		// Nothing
+	}).Name("download")
+
+	router.Get("/files/**/rev/:rev", func() {
+		// Nothing
+	}).Name("files")
+
 	// code should be 200 if none is returned from the handler
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "http://localhost:3000/bar/foo/bar", nil)
@@ -434,6 +1185,122 @@ func Test_URLFor(t *testing.T) {
 	router.Handle(recorder, req, context)
 }
 
+func Test_RouteParamConstraints(t *testing.T) {
+	m := Classic()
+	m.Get("/users/:id(\\d+)", func(params Params) string {
+		return "id " + params["id"]
+	})
+	m.Get("/users/:name", func(params Params) string {
+		return "name " + params["name"]
+	})
+	m.Get("/posts/:slug([a-z]+(-[a-z]+)*)/comments", func(params Params) string {
+		return "slug " + params["slug"]
+	})
+
+	for path, body := range map[string]string{
+		"/users/42":                   "id 42",
+		"/users/42/":                  "id 42",
+		"/users/bob":                  "name bob",
+		"/users/4b":                   "name 4b",
+		"/posts/hello-world/comments": "slug hello-world",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Body.String(), body)
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/posts/Hello/comments", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+}
+
+func Test_RouteCatchAll(t *testing.T) {
+	m := Classic()
+	m.Get("/files/:bucket/*filepath", func(params Params) string {
+		return params["bucket"] + ":" + params["filepath"]
+	})
+
+	for path, body := range map[string]string{
+		"/files/docs/readme.md":     "docs:readme.md",
+		"/files/docs/a/b/c.txt":     "docs:a/b/c.txt",
+		"/files/docs/":              "docs:",
+		"/files/docs/a/b?version=2": "docs:a/b",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Body.String(), body)
+	}
+}
+
+func Test_RouteCatchAll_NotLast(t *testing.T) {
+	for _, pattern := range []string{"/files/*filepath/edit", "/*a/*b"} {
+		func() {
+			defer func() {
+				refute(t, recover(), nil)
+			}()
+			NewRouter().Get(pattern, func() {})
+		}()
+	}
+}
+
+func Test_RouterMount(t *testing.T) {
+	admin := Classic()
+	admin.Get("/", func() string {
+		return "admin home"
+	})
+	admin.Get("/users/:id", func(params Params, req *http.Request) string {
+		return "admin user " + params["id"] + " " + req.URL.RawQuery
+	})
+
+	m := Classic()
+	m.Mount("/admin/", admin)
+	m.Get("/users/:id", func(params Params) string {
+		return "user " + params["id"]
+	})
+	m.Group("/api", func(r Router) {
+		r.Mount("/v1", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("v1 " + req.URL.Path))
+		}))
+	})
+
+	for path, body := range map[string]string{
+		"/admin":             "admin home",
+		"/admin/":            "admin home",
+		"/admin/users/7?x=1": "admin user 7 x=1",
+		"/users/7":           "user 7",
+		"/api/v1/a/b":        "v1 /a/b",
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://localhost:3000"+path, nil)
+		m.ServeHTTP(recorder, req)
+		expect(t, recorder.Body.String(), body)
+	}
+
+	// the mounted app answers for anything below its prefix
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/admin/missing", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/administrator", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+}
+
+func Test_URLFor_MissingParams(t *testing.T) {
+	router := NewRouter()
+	router.Get("/bar/:id/:name", func() {}).Name("bar_id")
+
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	router.URLFor("bar_id", 5)
+}
+
 func Test_AllRoutes(t *testing.T) {
 	router := NewRouter()
 
@@ -452,6 +1319,25 @@ func Test_AllRoutes(t *testing.T) {
 	}
 }
 
+func Test_RouteInfos(t *testing.T) {
+	m := Classic()
+	m.Get("/foo", func() {}).Name("foo")
+	m.Group("/api", func(r Router) {
+		r.Post("/users/:id", func() {})
+	})
+	m.Mount("/admin/", http.NotFoundHandler())
+	m.Get("/routes", func(routes Routes) []RouteInfo {
+		return routes.RouteInfos()
+	})
+	m.Map(JSONReturnHandler())
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/routes", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), `[{"method":"GET","pattern":"/foo","name":"foo"},`+
+		`{"method":"POST","pattern":"/api/users/:id"},{"method":"*","pattern":"/admin"},{"method":"GET","pattern":"/routes"}]`)
+}
+
 func Test_ActiveRoute(t *testing.T) {
 	router := NewRouter()
 
@@ -467,3 +1353,29 @@ func Test_ActiveRoute(t *testing.T) {
 	context.MapTo(router, (*Routes)(nil))
 	router.Handle(recorder, req, context)
 }
+
+func Test_ActiveRoute_Middleware(t *testing.T) {
+	m := New()
+	router := NewRouter()
+	router.Get("/users/:id", func() {})
+
+	pattern := ""
+	m.Use(func(c Context) {
+		c.Next()
+		if rv := c.Get(inject.InterfaceOf((*Route)(nil))); rv.IsValid() {
+			pattern = rv.Interface().(Route).Pattern()
+		}
+	})
+	m.Action(router.Handle)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users/5", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, pattern, "/users/:id")
+
+	pattern = ""
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/nope", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, pattern, "")
+}
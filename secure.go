@@ -0,0 +1,92 @@
+package martini
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecureOptions is a struct for specifying configuration options for the martini.SecureHeaders middleware.
+type SecureOptions struct {
+	// SSLRedirect redirects requests that are not made over HTTPS to the same URL with the https scheme.
+	SSLRedirect bool
+	// SSLHost is the host the requests are redirected to. Defaults to the host of the request.
+	SSLHost string
+	// STSMaxAge sets the max-age of the Strict-Transport-Security header, sent on HTTPS requests only. Not sent when zero.
+	STSMaxAge time.Duration
+	// STSIncludeSubdomains adds includeSubDomains to the Strict-Transport-Security header.
+	STSIncludeSubdomains bool
+	// STSPreload adds preload to the Strict-Transport-Security header.
+	STSPreload bool
+	// ContentTypeNosniff sends X-Content-Type-Options: nosniff.
+	ContentTypeNosniff bool
+	// FrameOptions is the value of the X-Frame-Options header, such as "DENY" or "SAMEORIGIN". Not sent when empty.
+	FrameOptions string
+	// ContentSecurityPolicy is the value of the Content-Security-Policy header. Not sent when empty.
+	ContentSecurityPolicy string
+}
+
+// SecureHeaders returns a middleware handler that sets the security headers turned on in opt, and with
+// SSLRedirect, redirects plain HTTP requests to HTTPS and aborts the chain. A request counts as made over
+// HTTPS when it came over TLS, or when a proxy set with SetTrustedProxies says so in X-Forwarded-Proto;
+// the header is ignored from anyone else, since any client can send it.
+func SecureHeaders(opt SecureOptions) Handler {
+	var sts string
+	if opt.STSMaxAge > 0 {
+		sts = "max-age=" + strconv.FormatInt(int64(opt.STSMaxAge/time.Second), 10)
+		if opt.STSIncludeSubdomains {
+			sts += "; includeSubDomains"
+		}
+		if opt.STSPreload {
+			sts += "; preload"
+		}
+	}
+
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		secure := isSecureRequest(req)
+		if opt.SSLRedirect && !secure {
+			host := opt.SSLHost
+			if host == "" {
+				host = req.Host
+			}
+			code := http.StatusMovedPermanently
+			if req.Method != "GET" && req.Method != "HEAD" {
+				// keep the method and body
+				code = http.StatusPermanentRedirect
+			}
+			http.Redirect(res, req, "https://"+host+req.URL.RequestURI(), code)
+			c.Abort()
+			return
+		}
+
+		header := res.Header()
+		if sts != "" && secure {
+			header.Set("Strict-Transport-Security", sts)
+		}
+		if opt.ContentTypeNosniff {
+			header.Set("X-Content-Type-Options", "nosniff")
+		}
+		if opt.FrameOptions != "" {
+			header.Set("X-Frame-Options", opt.FrameOptions)
+		}
+		if opt.ContentSecurityPolicy != "" {
+			header.Set("Content-Security-Policy", opt.ContentSecurityPolicy)
+		}
+	}
+}
+
+// isSecureRequest reports whether the request was made over HTTPS, as far as can be trusted.
+func isSecureRequest(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	if !isTrustedProxy(remoteHost(req)) {
+		return false
+	}
+	// proxies that append to the header leave the values the client sent in front, so only the last value,
+	// the one of the trusted proxy, can be believed
+	forwarded := strings.Split(strings.Join(req.Header["X-Forwarded-Proto"], ","), ",")
+	proto := strings.TrimSpace(forwarded[len(forwarded)-1])
+	return strings.EqualFold(proto, "https")
+}
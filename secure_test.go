@@ -0,0 +1,94 @@
+package martini
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_SecureHeaders(t *testing.T) {
+	m := Classic()
+	m.Use(SecureHeaders(SecureOptions{
+		STSMaxAge:             365 * 24 * time.Hour,
+		STSIncludeSubdomains:  true,
+		STSPreload:            true,
+		ContentTypeNosniff:    true,
+		FrameOptions:          "DENY",
+		ContentSecurityPolicy: "default-src 'self'",
+	}))
+	m.Get("/", func() string {
+		return "secure"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "https://localhost:3000/", nil)
+	req.TLS = &tls.ConnectionState{}
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "secure")
+	expect(t, recorder.HeaderMap.Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains; preload")
+	expect(t, recorder.HeaderMap.Get("X-Content-Type-Options"), "nosniff")
+	expect(t, recorder.HeaderMap.Get("X-Frame-Options"), "DENY")
+	expect(t, recorder.HeaderMap.Get("Content-Security-Policy"), "default-src 'self'")
+
+	// HSTS is only sent over HTTPS
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Body.String(), "secure")
+	expect(t, recorder.HeaderMap.Get("Strict-Transport-Security"), "")
+	expect(t, recorder.HeaderMap.Get("X-Frame-Options"), "DENY")
+}
+
+func Test_SecureHeaders_SSLRedirect(t *testing.T) {
+	defer SetTrustedProxies()
+	SetTrustedProxies("10.0.0.0/8")
+
+	m := Classic()
+	m.Use(SecureHeaders(SecureOptions{SSLRedirect: true, STSMaxAge: time.Hour}))
+	m.Get("/", func() string {
+		return "secure"
+	})
+	m.Post("/", func() string {
+		return "posted"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/?page=2", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusMovedPermanently)
+	expect(t, recorder.HeaderMap.Get("Location"), "https://example.com/?page=2")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "http://example.com/", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusPermanentRedirect)
+	refute(t, recorder.Body.String(), "posted")
+
+	// behind a trusted proxy terminating TLS
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.HeaderMap.Get("Strict-Transport-Security"), "max-age=3600")
+
+	// a client can't claim it through a proxy appending to the header
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-Proto", "https, http")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusMovedPermanently)
+	expect(t, recorder.HeaderMap.Get("Strict-Transport-Security"), "")
+
+	// nor by talking to the app directly
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusMovedPermanently)
+}
@@ -21,7 +21,8 @@ type StaticOptions struct {
 	// https://developers.google.com/speed/docs/insights/LeverageBrowserCaching
 	Expires func() string
 	// Fallback defines a default URL to serve when the requested resource was
-	// not found.
+	// not found. It is served with a 200, which lets single-page apps do their
+	// own client-side routing, e.g. StaticOptions{Fallback: "/index.html"}.
 	Fallback string
 	// Exclude defines a pattern for URLs this handler should never process.
 	Exclude string
@@ -54,10 +55,16 @@ func Static(directory string, staticOpt ...StaticOptions) Handler {
 	if !filepath.IsAbs(directory) {
 		directory = filepath.Join(Root, directory)
 	}
-	dir := http.Dir(directory)
+	return StaticFS(http.Dir(directory), staticOpt...)
+}
+
+// StaticFS returns a middleware handler that serves static files from the given http.FileSystem,
+// such as an embedded file system wrapped with http.FS. Requests other than GET and HEAD, and paths outside
+// the Prefix or under Exclude, are passed on without touching the file system.
+func StaticFS(dir http.FileSystem, staticOpt ...StaticOptions) Handler {
 	opt := prepareStaticOptions(staticOpt)
 
-	return func(res http.ResponseWriter, req *http.Request, log *log.Logger) {
+	return func(c Context, res http.ResponseWriter, req *http.Request, log *log.Logger) {
 		if req.Method != "GET" && req.Method != "HEAD" {
 			return
 		}
@@ -104,7 +111,7 @@ func Static(directory string, staticOpt ...StaticOptions) Handler {
 					RawQuery: req.URL.RawQuery,
 					Fragment: req.URL.Fragment,
 				}
-				http.Redirect(res, req, dest.String(), http.StatusFound)
+				http.Redirect(res, req, withBasePath(c, req, dest.String()), http.StatusFound)
 				return
 			}
 
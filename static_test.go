@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/codegangsta/inject"
@@ -237,6 +238,35 @@ func Test_Static_Options_Fallback(t *testing.T) {
 	expect(t, buffer.String(), "[martini] [Static] Serving /martini.go\n")
 }
 
+func Test_Static_Options_PrefixFallback(t *testing.T) {
+	var buffer bytes.Buffer
+	m := &Martini{Injector: inject.New(), action: func() {}, logger: log.New(&buffer, "[martini] ", 0)}
+	m.Map(m.logger)
+	m.Map(defaultReturnHandler())
+
+	m.Use(Static(currentRoot, StaticOptions{Prefix: "/app", Fallback: "/martini.go"}))
+
+	// Client-side routes under the prefix fall back
+	response := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://localhost:3000/app/users/42", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	m.ServeHTTP(response, req)
+	expect(t, response.Code, http.StatusOK)
+	expect(t, buffer.String(), "[martini] [Static] Serving /martini.go\n")
+
+	// Paths outside the prefix are left alone
+	buffer.Reset()
+	response = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://localhost:3000/users/42", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	m.ServeHTTP(response, req)
+	expect(t, buffer.String(), "")
+}
+
 func Test_Static_Redirect(t *testing.T) {
 	response := httptest.NewRecorder()
 
@@ -252,3 +282,85 @@ func Test_Static_Redirect(t *testing.T) {
 	expect(t, response.Code, http.StatusFound)
 	expect(t, response.Header().Get("Location"), "/public/?param=foo#bar")
 }
+
+// prefixFS serves the wrapped file system under a path prefix, so a hit
+// proves the file came through the given http.FileSystem.
+type prefixFS struct {
+	prefix string
+	fs     http.FileSystem
+}
+
+func (p prefixFS) Open(name string) (http.File, error) {
+	if !strings.HasPrefix(name, p.prefix) {
+		return nil, os.ErrNotExist
+	}
+	return p.fs.Open(strings.TrimPrefix(name, p.prefix))
+}
+
+func Test_StaticFS(t *testing.T) {
+	var buffer bytes.Buffer
+	m := &Martini{Injector: inject.New(), action: func() {}, logger: log.New(&buffer, "[martini] ", 0)}
+	m.Map(m.logger)
+	m.Map(defaultReturnHandler())
+
+	m.Use(StaticFS(prefixFS{"/embedded", http.Dir(currentRoot)}))
+
+	response := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://localhost:3000/embedded/martini.go", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	m.ServeHTTP(response, req)
+	expect(t, response.Code, http.StatusOK)
+	expect(t, buffer.String(), "[martini] [Static] Serving /embedded/martini.go\n")
+
+	// Files outside the file system are not served from disk
+	buffer.Reset()
+	response = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "http://localhost:3000/martini.go", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	m.ServeHTTP(response, req)
+	expect(t, buffer.String(), "")
+}
+
+// countingFS counts the files opened in the wrapped file system.
+type countingFS struct {
+	opened *int
+	fs     http.FileSystem
+}
+
+func (c countingFS) Open(name string) (http.File, error) {
+	*c.opened++
+	return c.fs.Open(name)
+}
+
+func Test_Static_SkipsFileSystem(t *testing.T) {
+	opened := 0
+	m := New()
+	m.Use(StaticFS(countingFS{&opened, http.Dir(currentRoot)}, StaticOptions{Prefix: "/public", SkipLogging: true}))
+	m.Use(func(res http.ResponseWriter) {
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, r := range []struct{ method, path string }{
+		{"POST", "/public/martini.go"},
+		{"PUT", "/public/martini.go"},
+		{"DELETE", "/public/martini.go"},
+		{"GET", "/api/users"},
+		{"GET", "/publicity"},
+	} {
+		response := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, "http://localhost:3000"+r.path, nil)
+		m.ServeHTTP(response, req)
+		expect(t, response.Code, http.StatusNoContent)
+	}
+	expect(t, opened, 0)
+
+	response := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/public/martini.go", nil)
+	m.ServeHTTP(response, req)
+	expect(t, response.Code, http.StatusOK)
+	expect(t, opened, 1)
+}
@@ -0,0 +1,59 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/codegangsta/inject"
+)
+
+// TestContext runs a request through a Martini without a server, recording the response. Services mapped on
+// it are request-level, just like the ones mapped from a handler, which makes it easy to stub dependencies:
+//
+//	tc := m.TestContext(httptest.NewRequest("GET", "/users/1", nil))
+//	tc.Map(fakeDB)
+//	res := tc.Run()
+//	// inspect res.Code, res.Body...
+type TestContext struct {
+	inject.Injector
+	// Request is the request being handled, with the base path stripped.
+	Request *http.Request
+	// Recorder records the response written by the handlers.
+	Recorder *httptest.ResponseRecorder
+
+	c       *context
+	outside bool // the request is outside of the base path, see Martini.SetBasePath
+}
+
+// TestContext creates a TestContext for the given request, a GET for "/" if req is nil. Like ServeHTTP, it
+// strips the base path set with SetBasePath from the request.
+func (m *Martini) TestContext(req *http.Request) *TestContext {
+	if req == nil {
+		req = httptest.NewRequest("GET", "/", nil)
+	}
+	recorder := httptest.NewRecorder()
+	mounted, prefix, ok := m.mountRequest(req)
+	if !ok {
+		mounted = req
+	}
+	c := m.createContext(recorder, mounted)
+	mapBasePath(c, prefix)
+	return &TestContext{c, mounted, recorder, c, !ok}
+}
+
+// Run runs the middleware stack and the action for the request, then returns the recorded response.
+// A TestContext can only be run once.
+func (t *TestContext) Run() *httptest.ResponseRecorder {
+	if t.outside {
+		notFound(t.Recorder, t.Request)
+		return t.Recorder
+	}
+	defer t.c.runDeferred()
+	t.c.run()
+	return t.Recorder
+}
+
+// Context returns the Context the handlers are run with.
+func (t *TestContext) Context() Context {
+	return t.c
+}
@@ -0,0 +1,73 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testGreeter interface {
+	Greet(name string) string
+}
+
+type fakeGreeter struct{}
+
+func (fakeGreeter) Greet(name string) string {
+	return "hi " + name
+}
+
+func Test_TestContext(t *testing.T) {
+	m := Classic()
+	m.Get("/hello/:name", func(g testGreeter, params Params) string {
+		return g.Greet(params["name"])
+	})
+
+	tc := m.TestContext(httptest.NewRequest("GET", "/hello/jeremy", nil))
+	tc.MapTo(fakeGreeter{}, (*testGreeter)(nil))
+	res := tc.Run()
+
+	expect(t, res, tc.Recorder)
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "hi jeremy")
+	expect(t, tc.Context().Written(), true)
+}
+
+func Test_TestContext_NilRequest(t *testing.T) {
+	m := New()
+	deferred := false
+	m.Use(func(c Context, req *http.Request) {
+		c.Defer(func() {
+			deferred = true
+		})
+		expect(t, req.URL.Path, "/")
+		c.AbortWithStatus(http.StatusTeapot)
+	})
+
+	res := m.TestContext(nil).Run()
+	expect(t, res.Code, http.StatusTeapot)
+	expect(t, deferred, true)
+}
+
+func Test_TestContext_BasePath(t *testing.T) {
+	m := Classic()
+	m.SetBasePath("/app")
+	m.Get("/users/:id", func(req *http.Request, params Params) string {
+		return params["id"] + " " + req.URL.Path
+	})
+	m.Get("/old", func(c Context) {
+		c.Redirect("/users/1")
+	})
+
+	tc := m.TestContext(httptest.NewRequest("GET", "/app/users/1", nil))
+	expect(t, tc.Request.URL.Path, "/users/1")
+	res := tc.Run()
+	expect(t, res.Code, http.StatusOK)
+	expect(t, res.Body.String(), "1 /users/1")
+
+	res = m.TestContext(httptest.NewRequest("GET", "/app/old", nil)).Run()
+	expect(t, res.Code, http.StatusFound)
+	expect(t, res.HeaderMap.Get("Location"), "/app/users/1")
+
+	res = m.TestContext(httptest.NewRequest("GET", "/users/1", nil)).Run()
+	expect(t, res.Code, http.StatusNotFound)
+}
@@ -0,0 +1,140 @@
+package martini
+
+import (
+	gocontext "context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timeout returns a middleware handler that limits how long the rest of the chain may take to respond.
+// The handlers that follow run with a request context.Context that is cancelled once d has passed, so
+// they can give up on slow work. If they haven't written the response by then, Timeout answers with a
+// 503 Service Unavailable right away and anything they write afterwards is discarded, their writes
+// returning http.ErrHandlerTimeout.
+func Timeout(d time.Duration) Handler {
+	return func(c Context) {
+		ctx, cancel := gocontext.WithTimeout(stdContext(c), d)
+		defer cancel()
+		mapStdContext(c, ctx)
+
+		tw := &timeoutWriter{ResponseWriter: c.ResponseWriter(), header: make(http.Header)}
+		for k, v := range tw.ResponseWriter.Header() {
+			tw.header[k] = v
+		}
+		c.MapTo(tw, (*http.ResponseWriter)(nil))
+
+		timer := time.AfterFunc(d, tw.timeout)
+		c.Next()
+		timer.Stop()
+		tw.finish()
+	}
+}
+
+// timeoutWriter guards the response with a lock, so the handlers and the timer racing to answer the
+// request only ever write it once. Headers are kept aside until the handlers write theirs, leaving the
+// timer free to write its 503 while they still run.
+type timeoutWriter struct {
+	ResponseWriter
+	mu       sync.Mutex
+	header   http.Header
+	timedOut bool
+	done     bool // the chain has returned, the timer may not write anymore
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(s int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeader(s)
+}
+
+func (w *timeoutWriter) writeHeader(s int) {
+	if w.timedOut || w.ResponseWriter.Written() {
+		return
+	}
+	dst := w.ResponseWriter.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	w.ResponseWriter.WriteHeader(s)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.ResponseWriter.Written() {
+		if w.header.Get("Content-Type") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(b))
+		}
+		w.writeHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.timedOut || w.ResponseWriter.Written()
+}
+
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done || w.ResponseWriter.Written() {
+		return
+	}
+	w.timedOut = true
+	body := []byte("503 service unavailable")
+	w.ResponseWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(body)
+	// net/http buffers the response until the handler returns, which the handlers may take long to do:
+	// with its length known, the client has the whole 503 once it is flushed
+	w.ResponseWriter.Flush()
+}
+
+// finish hands the response back to the handlers before Timeout once the chain has returned.
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if !w.timedOut && !w.ResponseWriter.Written() {
+		// keep the headers set so far, the response gets written later on
+		dst := w.ResponseWriter.Header()
+		for k, v := range w.header {
+			dst[k] = v
+		}
+	}
+}
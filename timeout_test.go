@@ -0,0 +1,94 @@
+package martini
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Timeout(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	m.Use(Timeout(10 * time.Millisecond))
+	written := make(chan error, 1)
+	m.Use(func(res http.ResponseWriter, ctx gocontext.Context) {
+		<-ctx.Done()
+		// give the timer the time to answer
+		time.Sleep(10 * time.Millisecond)
+		res.Header().Set("X-Late", "true")
+		_, err := res.Write([]byte("too late"))
+		written <- err
+	})
+	called := false
+	m.Use(func() {
+		called = true
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+
+	expect(t, <-written, http.ErrHandlerTimeout)
+	expect(t, called, false)
+	expect(t, recorder.Code, http.StatusServiceUnavailable)
+	expect(t, recorder.Body.String(), "503 service unavailable")
+	expect(t, recorder.HeaderMap.Get("X-Late"), "")
+}
+
+func Test_Timeout_InTime(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	m := New()
+	m.Use(func(res http.ResponseWriter) {
+		res.Header().Set("X-Before", "true")
+	})
+	m.Use(Timeout(time.Second))
+	m.Use(func(res http.ResponseWriter, ctx gocontext.Context) {
+		_, ok := ctx.Deadline()
+		expect(t, ok, true)
+		res.Header().Set("X-Handler", "true")
+		res.WriteHeader(http.StatusCreated)
+		res.Write([]byte("hello"))
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:3000/", nil)
+	m.ServeHTTP(recorder, req)
+
+	expect(t, recorder.Code, http.StatusCreated)
+	expect(t, recorder.Body.String(), "hello")
+	expect(t, recorder.HeaderMap.Get("X-Before"), "true")
+	expect(t, recorder.HeaderMap.Get("X-Handler"), "true")
+}
+
+func Test_Timeout_Server(t *testing.T) {
+	release := make(chan struct{})
+	m := New()
+	m.Use(Timeout(50 * time.Millisecond))
+	m.Use(func() {
+		// a handler that ignores the context.Context
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	expect(t, res.StatusCode, http.StatusServiceUnavailable)
+	expect(t, string(body), "503 service unavailable")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the 503 took %v to arrive", elapsed)
+	}
+}
@@ -0,0 +1,74 @@
+package martini
+
+import (
+	"mime/multipart"
+	"net/http"
+)
+
+// FormFile returns the first file uploaded in the named field of a multipart/form-data request. See FormFiles.
+func FormFile(req *http.Request, name string) (*multipart.FileHeader, error) {
+	files, err := FormFiles(req, name)
+	if err != nil {
+		return nil, err
+	}
+	return files[0], nil
+}
+
+// FormFiles returns the files uploaded in the named field of a multipart/form-data request, parsing the body
+// first unless the MultipartForm middleware or an earlier call did. It returns http.ErrMissingFile if the field
+// holds no file.
+func FormFiles(req *http.Request, name string) ([]*multipart.FileHeader, error) {
+	if req.MultipartForm == nil {
+		if err := req.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return nil, err
+		}
+	}
+	files := req.MultipartForm.File[name]
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files, nil
+}
+
+// MultipartForm returns a middleware handler that parses multipart/form-data bodies of up to maxSize bytes and
+// maps the *multipart.Form for the handlers that follow:
+//
+//	m.Post("/avatar", martini.MultipartForm(10<<20), func(form *multipart.Form) string { ... })
+//
+// Parts are kept in memory up to 32MB, the rest is stored in temporary files, removed once the handlers that
+// follow are done. A maxSize of 0 or less leaves the size unlimited. Larger bodies get a 413, requests that are
+// not multipart a 415 and malformed bodies a 400, all of which abort the chain.
+func MultipartForm(maxSize int64) Handler {
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		if maxSize > 0 {
+			if req.ContentLength > maxSize {
+				http.Error(res, "413 request entity too large", http.StatusRequestEntityTooLarge)
+				c.Abort()
+				return
+			}
+			if req.Body != nil {
+				req.Body = http.MaxBytesReader(res, req.Body, maxSize)
+			}
+		}
+
+		memory := int64(maxMultipartMemory)
+		if maxSize > 0 && maxSize < memory {
+			memory = maxSize
+		}
+		if err := req.ParseMultipartForm(memory); err != nil {
+			status := http.StatusBadRequest
+			if err == http.ErrNotMultipart {
+				status = http.StatusUnsupportedMediaType
+			} else if isBodyTooLarge(err) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(res, err.Error(), status)
+			c.Abort()
+			return
+		}
+		defer req.MultipartForm.RemoveAll()
+
+		c.Map(req.MultipartForm)
+		c.Next()
+	}
+}
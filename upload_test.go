@@ -0,0 +1,104 @@
+package martini
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newUploadRequest returns a multipart/form-data request uploading the files, keyed by field name.
+func newUploadRequest(t *testing.T, files map[string][]string) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for field, contents := range files {
+		for i, content := range contents {
+			part, err := w.CreateFormFile(field, field+string(rune('a'+i))+".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(content))
+		}
+	}
+	w.WriteField("name", "jeremy")
+	w.Close()
+
+	req, _ := http.NewRequest("POST", "http://localhost:3000/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func readFormFile(t *testing.T, fh *multipart.FileHeader) string {
+	f, err := fh.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, _ := ioutil.ReadAll(f)
+	return string(b)
+}
+
+func Test_FormFiles(t *testing.T) {
+	req := newUploadRequest(t, map[string][]string{"docs": {"one", "two"}})
+
+	files, err := FormFiles(req, "docs")
+	expect(t, err, nil)
+	expect(t, len(files), 2)
+	expect(t, files[0].Filename, "docsa.txt")
+	expect(t, readFormFile(t, files[1]), "two")
+
+	fh, err := FormFile(req, "docs")
+	expect(t, err, nil)
+	expect(t, readFormFile(t, fh), "one")
+
+	_, err = FormFile(req, "missing")
+	expect(t, err, http.ErrMissingFile)
+
+	req, _ = http.NewRequest("POST", "http://localhost:3000/upload", strings.NewReader("a=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = FormFiles(req, "docs")
+	expect(t, err, http.ErrNotMultipart)
+}
+
+func Test_MultipartForm(t *testing.T) {
+	m := Classic()
+	m.Post("/upload", MultipartForm(1<<20), func(form *multipart.Form, req *http.Request) string {
+		fh, err := FormFile(req, "avatar")
+		expect(t, err, nil)
+		return form.Value["name"][0] + " " + readFormFile(t, fh)
+	})
+
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, newUploadRequest(t, map[string][]string{"avatar": {"png"}}))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "jeremy png")
+
+	recorder = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://localhost:3000/upload", strings.NewReader("a=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusUnsupportedMediaType)
+}
+
+func Test_MultipartForm_TooLarge(t *testing.T) {
+	m := Classic()
+	m.Post("/upload", MultipartForm(64), func() string {
+		return "uploaded"
+	})
+
+	// announced in the Content-Length
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, newUploadRequest(t, map[string][]string{"avatar": {strings.Repeat("x", 100)}}))
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+
+	// found while reading
+	recorder = httptest.NewRecorder()
+	req := newUploadRequest(t, map[string][]string{"avatar": {strings.Repeat("x", 100)}})
+	req.ContentLength = -1
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	refute(t, recorder.Body.String(), "uploaded")
+}
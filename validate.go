@@ -0,0 +1,80 @@
+package martini
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/codegangsta/inject"
+)
+
+// requestTypes are the types Martini maps on every request, or on every routed request.
+var requestTypes = []reflect.Type{
+	inject.InterfaceOf((*Context)(nil)),
+	inject.InterfaceOf((*http.ResponseWriter)(nil)),
+	reflect.TypeOf((*http.Request)(nil)),
+	inject.InterfaceOf((*gocontext.Context)(nil)),
+	reflect.TypeOf(Params(nil)),
+	inject.InterfaceOf((*Route)(nil)),
+	reflect.TypeOf(RouteMeta{}),
+}
+
+// ValidateInjection turns on checking that every argument of a handler can be injected, when the handler is
+// added with Use, Handlers, Action and the like. A handler asking for a type that is neither mapped on the
+// Martini instance, mapped by Martini on every request (Context, http.ResponseWriter, *http.Request,
+// context.Context, Params, Route and RouteMeta) nor listed in requestScoped makes it panic right away,
+// rather than on the first request that reaches the handler. Handlers already added are checked too.
+//
+// Services mapped by middleware, such as the struct mapped by Bind, must be listed in requestScoped.
+// Global services must be mapped before the handlers needing them are added.
+func (m *Martini) ValidateInjection(requestScoped ...reflect.Type) {
+	m.injectables = make(map[reflect.Type]bool)
+	for _, t := range requestTypes {
+		m.injectables[t] = true
+	}
+	for _, t := range requestScoped {
+		m.injectables[t] = true
+	}
+
+	for _, handler := range m.GetHandlers() {
+		m.validateInjection(handler)
+	}
+	m.handlersLock.RLock()
+	action := m.action
+	m.handlersLock.RUnlock()
+	m.validateInjection(action)
+}
+
+// ValidateInjection turns on the checks of Martini.ValidateInjection, for the routes as well.
+func (m *ClassicMartini) ValidateInjection(requestScoped ...reflect.Type) {
+	m.Martini.ValidateInjection(requestScoped...)
+	if r, ok := m.Router.(*router); ok {
+		r.validate = m.validateInjection
+		for _, route := range r.getRoutes() {
+			for _, handler := range route.handlers {
+				r.validate(handler)
+			}
+		}
+	}
+}
+
+// validateHandler panics if handler is not a callable func, or, with ValidateInjection, cannot be injected.
+func (m *Martini) validateHandler(handler Handler) {
+	validateHandler(handler)
+	m.validateInjection(handler)
+}
+
+func (m *Martini) validateInjection(handler Handler) {
+	if m.injectables == nil {
+		return
+	}
+	t := reflect.TypeOf(handler)
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if m.injectables[in] || m.Get(in).IsValid() {
+			continue
+		}
+		panic(fmt.Sprintf("martini: handler %s asks for a %v, which is never mapped", handlerName(handler), in))
+	}
+}
@@ -0,0 +1,50 @@
+package martini
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type unmappedService struct{}
+
+func Test_ValidateInjection(t *testing.T) {
+	m := New()
+	m.Map(&unmappedService{})
+	m.ValidateInjection(reflect.TypeOf(AuthUser("")))
+
+	// mapped, request-level and listed types are fine
+	m.Use(func(c Context, res http.ResponseWriter, req *http.Request, s *unmappedService, u AuthUser) {})
+
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	m.Use(func(s unmappedService) {})
+}
+
+func Test_ValidateInjection_Off(t *testing.T) {
+	m := New()
+	// without ValidateInjection, handlers are only checked when invoked
+	m.Use(func(s unmappedService) {})
+}
+
+func Test_ValidateInjection_Existing(t *testing.T) {
+	m := New()
+	m.Use(func(s unmappedService) {})
+
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	m.ValidateInjection()
+}
+
+func Test_ValidateInjection_Routes(t *testing.T) {
+	m := Classic()
+	m.ValidateInjection()
+	m.Get("/", func(params Params, route Route, routes Routes) {})
+
+	defer func() {
+		refute(t, recover(), nil)
+	}()
+	m.Get("/users", func(s unmappedService) {})
+}
@@ -0,0 +1,26 @@
+package martini
+
+import (
+	"net/http"
+)
+
+// Wrap returns a handler that runs the standard http.Handler h, so that net/http handlers and middleware that
+// answer the request, or only set headers, can be used in a Martini stack or route:
+//
+//	m.Use(martini.Wrap(http.StripPrefix("/old", legacy)))
+//
+// If h wrote the response, through the ResponseWriter it was passed, the chain stops there as it would for any
+// handler. Otherwise the handlers that follow are called, through Context.Next, so h can't see their response.
+func Wrap(h http.Handler) Handler {
+	return func(c Context, res http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(res, req)
+		if !c.Written() {
+			c.Next()
+		}
+	}
+}
+
+// WrapFunc is like Wrap for a function with the http.HandlerFunc signature.
+func WrapFunc(f func(http.ResponseWriter, *http.Request)) Handler {
+	return Wrap(http.HandlerFunc(f))
+}
@@ -0,0 +1,32 @@
+package martini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Wrap(t *testing.T) {
+	m := Classic()
+	m.Use(WrapFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Powered-By", "net/http")
+	}))
+	m.Get("/hello", func() string {
+		return "hello"
+	})
+	m.Get("/legacy", Wrap(http.NotFoundHandler()), func() string {
+		return "not reached"
+	})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/hello", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.HeaderMap.Get("X-Powered-By"), "net/http")
+	expect(t, recorder.Body.String(), "hello")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://localhost:3000/legacy", nil)
+	m.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotFound)
+	expect(t, recorder.Body.String(), "404 page not found\n")
+}